@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Configuração do fetcher protegido contra SSRF. Os valores podem ser
+// ajustados pelas variáveis de ambiente:
+//
+//	FETCH_ALLOWLIST      hosts, IPs ou CIDRs liberados mesmo que sejam privados (separados por vírgula)
+//	FETCH_ALLOWED_PORTS  portas permitidas (padrão "80,443")
+//	FETCH_MAX_REDIRECTS  quantidade máxima de redirecionamentos (padrão 5)
+//	FETCH_MAX_BYTES      tamanho máximo da resposta em bytes (padrão 100MB)
+//	FETCH_TIMEOUT        timeout total da requisição em segundos (padrão 60)
+type fetchConfig struct {
+	allowHosts   []string
+	allowPrefix  []netip.Prefix
+	allowedPorts []string
+	maxRedirects int
+	maxBytes     int64
+	timeout      time.Duration
+}
+
+var errFetchBlocked = errors.New("destino bloqueado pela política de acesso a URLs remotas")
+
+// Faixas que não são cobertas pelos métodos de netip.Addr, mas que também não
+// devem ser acessíveis a partir de uma URL informada pelo cliente.
+var fetchBlockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// O cliente é criado sob demanda porque as variáveis do .env só são
+// carregadas no init() de main.go, depois da inicialização do pacote.
+var (
+	guardedClientOnce sync.Once
+	guardedClient     *http.Client
+	guardedConfig     fetchConfig
+)
+
+func getGuardedClient() (*http.Client, fetchConfig) {
+	guardedClientOnce.Do(func() {
+		guardedConfig = loadFetchConfig()
+		guardedClient = newGuardedClient(guardedConfig)
+	})
+	return guardedClient, guardedConfig
+}
+
+func loadFetchConfig() fetchConfig {
+	cfg := fetchConfig{
+		allowedPorts: []string{"80", "443"},
+		maxRedirects: 5,
+		maxBytes:     100 << 20,
+		timeout:      60 * time.Second,
+	}
+
+	for _, entry := range strings.Split(os.Getenv("FETCH_ALLOWLIST"), ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			cfg.allowPrefix = append(cfg.allowPrefix, prefix.Masked())
+		} else if addr, err := netip.ParseAddr(entry); err == nil {
+			cfg.allowPrefix = append(cfg.allowPrefix, netip.PrefixFrom(addr, addr.BitLen()))
+		} else {
+			cfg.allowHosts = append(cfg.allowHosts, entry)
+		}
+	}
+
+	if v := os.Getenv("FETCH_ALLOWED_PORTS"); v != "" {
+		cfg.allowedPorts = nil
+		for _, p := range strings.Split(v, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				cfg.allowedPorts = append(cfg.allowedPorts, p)
+			}
+		}
+	}
+	if v, err := strconv.Atoi(os.Getenv("FETCH_MAX_REDIRECTS")); err == nil && v >= 0 {
+		cfg.maxRedirects = v
+	}
+	if v, err := strconv.ParseInt(os.Getenv("FETCH_MAX_BYTES"), 10, 64); err == nil && v > 0 {
+		cfg.maxBytes = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("FETCH_TIMEOUT")); err == nil && v > 0 {
+		cfg.timeout = time.Duration(v) * time.Second
+	}
+	return cfg
+}
+
+// isHostAllowed indica se o host foi liberado explicitamente na allowlist.
+func (cfg fetchConfig) isHostAllowed(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, h := range cfg.allowHosts {
+		if host == h || (strings.HasPrefix(h, ".") && strings.HasSuffix(host, h)) {
+			return true
+		}
+	}
+	return false
+}
+
+// isAddrAllowed verifica se o IP pode ser acessado: endereços públicos sempre,
+// privados/loopback/link-local apenas se estiverem na allowlist.
+func (cfg fetchConfig) isAddrAllowed(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range cfg.allowPrefix {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return false
+	}
+	for _, prefix := range fetchBlockedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkURL valida esquema, porta e host antes de qualquer conexão.
+// A verificação dos IPs é repetida no momento da conexão (dialer), o que
+// impede que uma nova resolução de DNS troque o destino (DNS rebinding).
+func (cfg fetchConfig) checkURL(ctx context.Context, u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: esquema %q não permitido", errFetchBlocked, u.Scheme)
+	}
+	if u.User != nil {
+		return fmt.Errorf("%w: credenciais na URL não são permitidas", errFetchBlocked)
+	}
+
+	host := u.Hostname()
+	if host == "" {
+		return fmt.Errorf("%w: host vazio", errFetchBlocked)
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	if !Find(cfg.allowedPorts, port) {
+		return fmt.Errorf("%w: porta %s não permitida", errFetchBlocked, port)
+	}
+
+	if cfg.isHostAllowed(host) {
+		return nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return fmt.Errorf("falha ao resolver host %s: %v", host, err)
+	}
+	for _, addr := range addrs {
+		addr = addr.Unmap()
+		if !cfg.isAddrAllowed(addr) {
+			return fmt.Errorf("%w: %s resolve para endereço interno %s", errFetchBlocked, host, addr)
+		}
+	}
+	return nil
+}
+
+// newGuardedClient cria um http.Client que resolve o DNS, bloqueia faixas
+// internas, limita e revalida redirecionamentos e ignora proxies do ambiente.
+func newGuardedClient(cfg fetchConfig) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   15 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrport, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return fmt.Errorf("%w: endereço inválido %s", errFetchBlocked, address)
+			}
+			if !cfg.isAddrAllowed(addrport.Addr()) {
+				return fmt.Errorf("%w: conexão para %s recusada", errFetchBlocked, addrport.Addr())
+			}
+			return nil
+		},
+	}
+
+	transport := &http.Transport{
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          20,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+
+	return &http.Client{
+		Transport: &guardedTransport{cfg: cfg, next: transport},
+		Timeout:   cfg.timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= cfg.maxRedirects {
+				return fmt.Errorf("%w: limite de %d redirecionamentos excedido", errFetchBlocked, cfg.maxRedirects)
+			}
+			return nil
+		},
+	}
+}
+
+// guardedTransport valida cada requisição (inclusive as geradas por
+// redirecionamentos) antes de repassá-la ao transporte real.
+type guardedTransport struct {
+	cfg  fetchConfig
+	next http.RoundTripper
+}
+
+func (t *guardedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.cfg.checkURL(req.Context(), req.URL); err != nil {
+		return nil, err
+	}
+	if t.cfg.isHostAllowed(req.URL.Hostname()) {
+		return allowlistTransport.RoundTrip(req)
+	}
+	return t.next.RoundTrip(req)
+}
+
+// allowlistTransport é usado para hosts liberados por nome na allowlist,
+// que podem resolver para endereços internos.
+var allowlistTransport = &http.Transport{
+	Proxy:               nil,
+	DialContext:         (&net.Dialer{Timeout: 15 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+	TLSHandshakeTimeout: 10 * time.Second,
+	IdleConnTimeout:     90 * time.Second,
+}
+
+// fetchRemote faz um GET protegido e retorna o corpo da resposta, respeitando
+// o limite de tamanho configurado.
+func fetchRemote(ctx context.Context, rawURL string) ([]byte, http.Header, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("URL inválida: %v", err)
+	}
+	client, cfg := getGuardedClient()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("URL inválida: %v", err)
+	}
+	req.Header.Set("User-Agent", "wuzapi")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, resp.Header, fmt.Errorf("status code: %d", resp.StatusCode)
+	}
+	if resp.ContentLength > cfg.maxBytes {
+		return nil, resp.Header, fmt.Errorf("conteúdo excede o limite de %d bytes", cfg.maxBytes)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, cfg.maxBytes+1))
+	if err != nil {
+		return nil, resp.Header, err
+	}
+	if int64(len(body)) > cfg.maxBytes {
+		return nil, resp.Header, fmt.Errorf("conteúdo excede o limite de %d bytes", cfg.maxBytes)
+	}
+	return body, resp.Header, nil
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"go.mau.fi/whatsmeow"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+// CallSettings is the per user policy for incoming calls
+type CallSettings struct {
+	AutoReject    bool   `db:"auto_reject"`
+	RejectMessage string `db:"reject_message"`
+}
+
+// loadCallSettings returns the call settings of a user, or the defaults
+func loadCallSettings(db *sqlx.DB, userID int) CallSettings {
+	var settings CallSettings
+	err := db.Get(&settings, "SELECT auto_reject, reject_message FROM call_settings WHERE user_id=$1", userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Warn().Err(err).Msg("Could not read call settings")
+	}
+	return settings
+}
+
+// logCall records a call in the message store as a call log message on the
+// caller's chat. Later events of the same call update its outcome.
+func logCall(store *MessageStore, userID int, meta types.BasicCallMeta, isVideo bool, outcome waProto.CallLogMessage_CallOutcome) {
+	chat := meta.From.ToNonAD()
+	callLog := &waProto.CallLogMessage{IsVideo: proto.Bool(isVideo)}
+	if stored, err := store.Get(userID, chat, meta.CallID); err == nil {
+		if msg, err := stored.Decode(); err == nil && msg.GetCallLogMesssage() != nil {
+			callLog = msg.GetCallLogMesssage()
+		}
+	}
+	callLog.CallOutcome = outcome.Enum()
+
+	timestamp := meta.Timestamp
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+
+	info := types.MessageInfo{
+		MessageSource: types.MessageSource{Chat: chat, Sender: meta.CallCreator.ToNonAD()},
+		ID:            meta.CallID,
+		Timestamp:     timestamp,
+	}
+	store.Upsert(userID, info, &waProto.Message{CallLogMesssage: callLog})
+}
+
+// autoRejectCall rejects an incoming call and sends the reject message to
+// the caller, when the user enabled it, with the disappearing timer of
+// their chat
+func autoRejectCall(cli *whatsmeow.Client, settings CallSettings, from types.JID, callID string, expiration uint32) error {
+	err := cli.RejectCall(from, callID)
+	if err != nil {
+		return err
+	}
+	// sent in the background so the event handler is not held waiting for the server
+	if settings.RejectMessage != "" {
+		go func() {
+			msg := &waProto.Message{ExtendedTextMessage: &waProto.ExtendedTextMessage{Text: proto.String(settings.RejectMessage)}}
+			applyChatExpiration(msg, expiration)
+			_, err := cli.SendMessage(context.Background(), from.ToNonAD(), msg)
+			if err != nil {
+				log.Warn().Err(err).Str("to", from.String()).Msg("Could not send call reject message")
+			}
+		}()
+	}
+	return nil
+}
+
+// Gets the incoming call policy
+func (s *server) GetCallSettings() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+		userid, _ := strconv.Atoi(txtid)
+
+		responseJson, err := json.Marshal(loadCallSettings(s.db, userid))
+
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+		} else {
+			s.Respond(w, r, http.StatusOK, string(responseJson))
+		}
+
+		return
+	}
+}
+
+// Sets the incoming call policy: AutoReject rejects every call and
+// RejectMessage, when set, is sent to the caller as a text message
+func (s *server) SetCallSettings() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+		userid, _ := strconv.Atoi(txtid)
+
+		decoder := json.NewDecoder(r.Body)
+		var t CallSettings
+		err := decoder.Decode(&t)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Could not decode Payload"))
+			return
+		}
+
+		_, err = s.db.Exec(`INSERT INTO call_settings (user_id, auto_reject, reject_message, updated_at) VALUES ($1, $2, $3, NOW())
+			ON CONFLICT (user_id) DO UPDATE SET auto_reject=EXCLUDED.auto_reject, reject_message=EXCLUDED.reject_message, updated_at=NOW()`,
+			userid, t.AutoReject, t.RejectMessage)
+		if err != nil {
+			log.Error().Str("error", fmt.Sprintf("%v", err)).Msg("Failed to save call settings")
+			s.Respond(w, r, http.StatusInternalServerError, errors.New("Failed to save call settings"))
+			return
+		}
+
+		responseJson, err := json.Marshal(t)
+
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+		} else {
+			s.Respond(w, r, http.StatusOK, string(responseJson))
+		}
+
+		return
+	}
+}
+
+// Rejects an incoming call
+func (s *server) RejectCall() http.HandlerFunc {
+
+	type rejectCallStruct struct {
+		Phone   string
+		CallID  string
+		Message string
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+		userid, _ := strconv.Atoi(txtid)
+
+		if clientPointer[userid] == nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New("No session"))
+			return
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		var t rejectCallStruct
+		err := decoder.Decode(&t)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Could not decode Payload"))
+			return
+		}
+
+		if t.Phone == "" {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Missing Phone in Payload"))
+			return
+		}
+
+		if t.CallID == "" {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Missing CallID in Payload"))
+			return
+		}
+
+		from, err := s.resolveRecipient(clientPointer[userid], t.Phone)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		expiration := s.chatExpiration(clientPointer[userid], userid, from.ToNonAD())
+		err = autoRejectCall(clientPointer[userid], CallSettings{RejectMessage: t.Message}, from, t.CallID, expiration)
+		if err != nil {
+			log.Error().Str("error", fmt.Sprintf("%v", err)).Msg("Failed to reject call")
+			msg := fmt.Sprintf("Failed to reject call: %v", err)
+			s.Respond(w, r, http.StatusInternalServerError, msg)
+			return
+		}
+		logCall(s.messages, userid, types.BasicCallMeta{From: from, CallCreator: from, CallID: t.CallID}, false, waProto.CallLogMessage_REJECTED)
+
+		response := map[string]interface{}{"Details": "Call rejected"}
+		responseJson, err := json.Marshal(response)
+
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+		} else {
+			s.Respond(w, r, http.StatusOK, string(responseJson))
+		}
+
+		return
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Group types returned by ListGroups
+const (
+	groupTypeCommunity    = "community"
+	groupTypeAnnouncement = "announcement"
+	groupTypeGroup        = "group"
+)
+
+// groupType tells community parents and their announcement groups apart
+// from regular groups (linked subgroups included)
+func groupType(info *types.GroupInfo) string {
+	if info.IsParent {
+		return groupTypeCommunity
+	}
+	if info.IsDefaultSubGroup {
+		return groupTypeAnnouncement
+	}
+	return groupTypeGroup
+}
+
+// parseCommunityJID parses the CommunityJID sent on community payloads
+func parseCommunityJID(communityJID string) (types.JID, error) {
+	if communityJID == "" {
+		return types.JID{}, errors.New("Missing CommunityJID in Payload")
+	}
+	community, ok := parseJID(communityJID)
+	if !ok {
+		return types.JID{}, errors.New("Could not parse Community JID")
+	}
+	return community, nil
+}
+
+// Create community, the announcement group is created by WhatsApp
+func (s *server) CreateCommunity() http.HandlerFunc {
+
+	type createCommunityStruct struct {
+		Name         string
+		Participants []string
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+		userid, _ := strconv.Atoi(txtid)
+
+		if clientPointer[userid] == nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New("No session"))
+			return
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		var t createCommunityStruct
+		err := decoder.Decode(&t)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Could not decode Payload"))
+			return
+		}
+
+		if t.Name == "" {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Missing Name in Payload"))
+			return
+		}
+
+		var participants []types.JID
+		if len(t.Participants) > 0 {
+			participants, err = s.resolveParticipants(clientPointer[userid], t.Participants)
+			if err != nil {
+				s.Respond(w, r, http.StatusBadRequest, err)
+				return
+			}
+		}
+
+		info, err := clientPointer[userid].CreateGroup(whatsmeow.ReqCreateGroup{
+			Name:         t.Name,
+			Participants: participants,
+			GroupParent:  types.GroupParent{IsParent: true},
+		})
+		if err != nil {
+			log.Error().Str("error", fmt.Sprintf("%v", err)).Msg("Failed to create community")
+			msg := fmt.Sprintf("Failed to create community: %v", err)
+			s.Respond(w, r, http.StatusInternalServerError, msg)
+			return
+		}
+
+		response := map[string]interface{}{
+			"GroupInfo":    info,
+			"Participants": newParticipantResults(info.Participants),
+		}
+		responseJson, err := json.Marshal(response)
+
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+		} else {
+			s.Respond(w, r, http.StatusOK, string(responseJson))
+		}
+
+		return
+	}
+}
+
+// Link or unlink an existing group to a community
+func (s *server) UpdateCommunityGroup(link bool) http.HandlerFunc {
+
+	type communityGroupStruct struct {
+		CommunityJID string
+		GroupJID     string
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+		userid, _ := strconv.Atoi(txtid)
+
+		if clientPointer[userid] == nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New("No session"))
+			return
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		var t communityGroupStruct
+		err := decoder.Decode(&t)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Could not decode Payload"))
+			return
+		}
+
+		community, err := parseCommunityJID(t.CommunityJID)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		group, err := parseGroupJID(t.GroupJID)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		action, details := "link", "Group linked successfully"
+		if link {
+			err = clientPointer[userid].LinkGroup(community, group)
+		} else {
+			action, details = "unlink", "Group unlinked successfully"
+			err = clientPointer[userid].UnlinkGroup(community, group)
+		}
+		if err != nil {
+			log.Error().Str("error", fmt.Sprintf("%v", err)).Msg("Failed to " + action + " group")
+			msg := fmt.Sprintf("Failed to %s group: %v", action, err)
+			s.Respond(w, r, http.StatusInternalServerError, msg)
+			return
+		}
+
+		response := map[string]interface{}{"Details": details}
+		responseJson, err := json.Marshal(response)
+
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+		} else {
+			s.Respond(w, r, http.StatusOK, string(responseJson))
+		}
+
+		return
+	}
+}
+
+// List the subgroups of a community
+func (s *server) ListCommunitySubGroups() http.HandlerFunc {
+
+	type subGroup struct {
+		JID  string
+		Name string
+		Type string
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+		userid, _ := strconv.Atoi(txtid)
+
+		if clientPointer[userid] == nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New("No session"))
+			return
+		}
+
+		communityJID := r.URL.Query().Get("communityJID")
+		if communityJID == "" {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Missing communityJID parameter"))
+			return
+		}
+
+		community, err := parseCommunityJID(communityJID)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		resp, err := clientPointer[userid].GetSubGroups(community)
+		if err != nil {
+			log.Error().Str("error", fmt.Sprintf("%v", err)).Msg("Failed to get community subgroups")
+			msg := fmt.Sprintf("Failed to get community subgroups: %v", err)
+			s.Respond(w, r, http.StatusInternalServerError, msg)
+			return
+		}
+
+		groups := make([]subGroup, 0, len(resp))
+		for _, group := range resp {
+			subType := groupTypeGroup
+			if group.IsDefaultSubGroup {
+				subType = groupTypeAnnouncement
+			}
+			groups = append(groups, subGroup{JID: group.JID.String(), Name: group.Name, Type: subType})
+		}
+
+		response := map[string]interface{}{"Groups": groups}
+		responseJson, err := json.Marshal(response)
+
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+		} else {
+			s.Respond(w, r, http.StatusOK, string(responseJson))
+		}
+
+		return
+	}
+}
+
+// List the participants of all groups linked to a community
+func (s *server) ListCommunityParticipants() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+		userid, _ := strconv.Atoi(txtid)
+
+		if clientPointer[userid] == nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New("No session"))
+			return
+		}
+
+		communityJID := r.URL.Query().Get("communityJID")
+		if communityJID == "" {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Missing communityJID parameter"))
+			return
+		}
+
+		community, err := parseCommunityJID(communityJID)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		resp, err := clientPointer[userid].GetLinkedGroupsParticipants(community)
+		if err != nil {
+			log.Error().Str("error", fmt.Sprintf("%v", err)).Msg("Failed to get community participants")
+			msg := fmt.Sprintf("Failed to get community participants: %v", err)
+			s.Respond(w, r, http.StatusInternalServerError, msg)
+			return
+		}
+
+		participants := make([]string, 0, len(resp))
+		for _, jid := range resp {
+			participants = append(participants, jid.String())
+		}
+
+		response := map[string]interface{}{"Participants": participants}
+		responseJson, err := json.Marshal(response)
+
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+		} else {
+			s.Respond(w, r, http.StatusOK, string(responseJson))
+		}
+
+		return
+	}
+}
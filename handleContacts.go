@@ -0,0 +1,362 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/appstate"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+// Whether a contact has a profile picture, per user and contact
+var avatarCache = cache.New(time.Hour, 2*time.Hour)
+
+const (
+	contactsDefaultLimit = 100
+	contactsMaxLimit     = 1000
+
+	// profile pictures checked in parallel, and at most per request, by
+	// the hasAvatar filter
+	avatarLookupConcurrency = 8
+	avatarLookupMax         = 500
+)
+
+type contactEntry struct {
+	JID          string
+	FirstName    string
+	FullName     string
+	PushName     string
+	BusinessName string
+	Saved        bool
+	Business     bool
+	HasAvatar    *bool `json:",omitempty"`
+}
+
+func (c *contactEntry) displayName() string {
+	for _, name := range []string{c.FullName, c.FirstName, c.PushName, c.BusinessName} {
+		if name != "" {
+			return strings.ToLower(name)
+		}
+	}
+	return "~" + c.JID
+}
+
+// parseBoolFilter parses an optional true/false query parameter
+func parseBoolFilter(r *http.Request, name string) (*bool, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid %s parameter, must be true or false", name)
+	}
+	return &parsed, nil
+}
+
+// hasAvatar checks if the contact has a profile picture visible to us. known
+// is false when the picture could not be checked, and the answer is not cached.
+func hasAvatar(userid int, cli *whatsmeow.Client, jid types.JID) (found bool, known bool) {
+	key := strconv.Itoa(userid) + ":" + jid.String()
+	if cached, found := avatarCache.Get(key); found {
+		return cached.(bool), true
+	}
+	pic, err := cli.GetProfilePictureInfo(jid, &whatsmeow.GetProfilePictureParams{Preview: true})
+	if err != nil && !errors.Is(err, whatsmeow.ErrProfilePictureNotSet) && !errors.Is(err, whatsmeow.ErrProfilePictureUnauthorized) {
+		log.Warn().Err(err).Str("jid", jid.String()).Msg("Could not get profile picture")
+		return false, false
+	}
+	found = err == nil && pic != nil
+	avatarCache.Set(key, found, cache.DefaultExpiration)
+	return found, true
+}
+
+// avatarCached tells if the picture of the contact is already in the cache
+func avatarCached(userid int, jid types.JID) bool {
+	_, found := avatarCache.Get(strconv.Itoa(userid) + ":" + jid.String())
+	return found
+}
+
+// Gets contacts. Without parameters returns all contacts as before, with
+// page, limit, search, saved, business or hasAvatar returns a page.
+func (s *server) GetContacts() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+		userid, _ := strconv.Atoi(txtid)
+
+		if clientPointer[userid] == nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New("No session"))
+			return
+		}
+
+		result, err := clientPointer[userid].Store.Contacts.GetAllContacts()
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		if len(r.URL.Query()) == 0 {
+			responseJson, err := json.Marshal(result)
+			if err != nil {
+				s.Respond(w, r, http.StatusInternalServerError, err)
+			} else {
+				s.Respond(w, r, http.StatusOK, string(responseJson))
+			}
+			return
+		}
+
+		query := r.URL.Query()
+		page, limit := 1, contactsDefaultLimit
+		if v := query.Get("page"); v != "" {
+			page, err = strconv.Atoi(v)
+			if err != nil || page < 1 {
+				s.Respond(w, r, http.StatusBadRequest, errors.New("Invalid page parameter"))
+				return
+			}
+		}
+		if v := query.Get("limit"); v != "" {
+			limit, err = strconv.Atoi(v)
+			if err != nil || limit < 1 || limit > contactsMaxLimit {
+				s.Respond(w, r, http.StatusBadRequest, fmt.Errorf("Invalid limit parameter, must be between 1 and %d", contactsMaxLimit))
+				return
+			}
+		}
+		saved, err := parseBoolFilter(r, "saved")
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, err)
+			return
+		}
+		business, err := parseBoolFilter(r, "business")
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, err)
+			return
+		}
+		withAvatar, err := parseBoolFilter(r, "hasAvatar")
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, err)
+			return
+		}
+		search := strings.ToLower(strings.TrimSpace(query.Get("search")))
+		searchDigits := onlyDigits(search)
+
+		contacts := make([]contactEntry, 0, len(result))
+		jids := make(map[string]types.JID, len(result))
+		for jid, info := range result {
+			entry := contactEntry{
+				JID:          jid.String(),
+				FirstName:    info.FirstName,
+				FullName:     info.FullName,
+				PushName:     info.PushName,
+				BusinessName: info.BusinessName,
+				Saved:        info.FullName != "" || info.FirstName != "",
+				Business:     info.BusinessName != "",
+			}
+			if saved != nil && entry.Saved != *saved {
+				continue
+			}
+			if business != nil && entry.Business != *business {
+				continue
+			}
+			if search != "" {
+				names := strings.ToLower(strings.Join([]string{info.FullName, info.FirstName, info.PushName, info.BusinessName}, "\n"))
+				if !strings.Contains(names, search) && (searchDigits == "" || !strings.Contains(jid.User, searchDigits)) {
+					continue
+				}
+			}
+			contacts = append(contacts, entry)
+			jids[entry.JID] = jid
+		}
+
+		sort.Slice(contacts, func(i, j int) bool {
+			a, b := contacts[i].displayName(), contacts[j].displayName()
+			if a != b {
+				return a < b
+			}
+			return contacts[i].JID < contacts[j].JID
+		})
+
+		// The avatar filter needs a request per contact, so contacts are only
+		// checked until the page is filled and the total is not known
+		total := len(contacts)
+		offset := (page - 1) * limit
+		var pageContacts []contactEntry
+		hasMore, truncated, unknown := false, false, 0
+		if withAvatar == nil {
+			if offset < len(contacts) {
+				end := offset + limit
+				if end > len(contacts) {
+					end = len(contacts)
+				}
+				pageContacts = contacts[offset:end]
+				hasMore = end < len(contacts)
+			}
+		} else {
+			total = -1
+			matched, lookups := 0, 0
+		chunks:
+			for start := 0; start < len(contacts); start += avatarLookupConcurrency {
+				if lookups >= avatarLookupMax {
+					// the rest is left for the next requests, once cached
+					truncated, hasMore = true, true
+					break
+				}
+				end := start + avatarLookupConcurrency
+				if end > len(contacts) {
+					end = len(contacts)
+				}
+				found := make([]bool, end-start)
+				known := make([]bool, end-start)
+				var wg sync.WaitGroup
+				for i := start; i < end; i++ {
+					jid := jids[contacts[i].JID]
+					if !avatarCached(userid, jid) {
+						lookups++
+					}
+					wg.Add(1)
+					go func(i int, jid types.JID) {
+						defer wg.Done()
+						found[i-start], known[i-start] = hasAvatar(userid, clientPointer[userid], jid)
+					}(i, jid)
+				}
+				wg.Wait()
+
+				for i := start; i < end; i++ {
+					if !known[i-start] {
+						unknown++
+						continue
+					}
+					if found[i-start] != *withAvatar {
+						continue
+					}
+					if matched >= offset+limit {
+						hasMore = true
+						break chunks
+					}
+					if matched >= offset {
+						contacts[i].HasAvatar = proto.Bool(found[i-start])
+						pageContacts = append(pageContacts, contacts[i])
+					}
+					matched++
+				}
+			}
+		}
+		if pageContacts == nil {
+			pageContacts = []contactEntry{}
+		}
+
+		response := map[string]interface{}{
+			"Contacts": pageContacts,
+			"Page":     page,
+			"Limit":    limit,
+			"Total":    total,
+			"HasMore":  hasMore,
+		}
+		if withAvatar != nil {
+			response["Unknown"] = unknown
+			response["Truncated"] = truncated
+		}
+		responseJson, err := json.Marshal(response)
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+		} else {
+			s.Respond(w, r, http.StatusOK, string(responseJson))
+		}
+
+		return
+	}
+}
+
+// Saves or updates a contact name in the address book (app state)
+func (s *server) SaveContact() http.HandlerFunc {
+
+	type saveContactStruct struct {
+		Phone     string
+		FirstName string
+		FullName  string
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+		userid, _ := strconv.Atoi(txtid)
+
+		if clientPointer[userid] == nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New("No session"))
+			return
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		var t saveContactStruct
+		err := decoder.Decode(&t)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Could not decode Payload"))
+			return
+		}
+
+		if t.Phone == "" {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Missing Phone in Payload"))
+			return
+		}
+
+		t.FullName = strings.TrimSpace(t.FullName)
+		if t.FullName == "" {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Missing FullName in Payload"))
+			return
+		}
+		if t.FirstName == "" {
+			t.FirstName = strings.Fields(t.FullName)[0]
+		}
+
+		jid, err := s.resolveRecipient(clientPointer[userid], t.Phone)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		patch := appstate.PatchInfo{
+			Type: appstate.WAPatchCriticalUnblockLow,
+			Mutations: []appstate.MutationInfo{{
+				Index:   []string{appstate.IndexContact, jid.String()},
+				Version: 2,
+				Value: &waProto.SyncActionValue{
+					ContactAction: &waProto.ContactAction{
+						FullName:                 proto.String(t.FullName),
+						FirstName:                proto.String(t.FirstName),
+						SaveOnPrimaryAddressbook: proto.Bool(true),
+					},
+				},
+			}},
+		}
+		err = clientPointer[userid].SendAppState(patch)
+		if err != nil {
+			log.Error().Str("error", fmt.Sprintf("%v", err)).Msg("Failed to save contact")
+			msg := fmt.Sprintf("Failed to save contact: %v", err)
+			s.Respond(w, r, http.StatusInternalServerError, msg)
+			return
+		}
+
+		response := map[string]interface{}{"Details": "Contact saved successfully", "JID": jid.String()}
+		responseJson, err := json.Marshal(response)
+
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+		} else {
+			s.Respond(w, r, http.StatusOK, string(responseJson))
+		}
+
+		return
+	}
+}
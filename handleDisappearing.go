@@ -0,0 +1,235 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"go.mau.fi/whatsmeow"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+// expirationChat returns the chat the timer is kept under. Private chats
+// addressed by LID use the phone number when it is known, like sends do.
+func expirationChat(resolver *JIDResolver, chat types.JID) types.JID {
+	chat = chat.ToNonAD()
+	if chat.Server == types.HiddenUserServer {
+		return resolver.resolveLID(chat).JID.ToNonAD()
+	}
+	return chat
+}
+
+// loadChatExpiration returns the disappearing messages timer of a chat in
+// seconds, and whether it is known
+func loadChatExpiration(db *sqlx.DB, resolver *JIDResolver, userID int, chat types.JID) (uint32, bool) {
+	chats := []string{expirationChat(resolver, chat).String()}
+	// the timer may have been learned before the LID of the number was known
+	if chat.Server == types.DefaultUserServer {
+		if lid := resolver.LIDFor(chat); lid.User != "" {
+			chats = append(chats, lid.ToNonAD().String())
+		}
+	}
+	for _, key := range chats {
+		var expiration uint32
+		err := db.Get(&expiration, "SELECT expiration FROM chat_ephemeral WHERE user_id=$1 AND chat=$2", userID, key)
+		if err == nil {
+			return expiration, true
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Warn().Err(err).Msg("Could not read chat expiration")
+			break
+		}
+	}
+	return 0, false
+}
+
+// saveChatExpiration records the disappearing messages timer of a chat
+func saveChatExpiration(db *sqlx.DB, resolver *JIDResolver, userID int, chat types.JID, expiration uint32) {
+	_, err := db.Exec(`INSERT INTO chat_ephemeral (user_id, chat, expiration, updated_at) VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (user_id, chat) DO UPDATE SET expiration=EXCLUDED.expiration, updated_at=NOW()`,
+		userID, expirationChat(resolver, chat).String(), expiration)
+	if err != nil {
+		log.Warn().Err(err).Str("chat", chat.String()).Msg("Could not save chat expiration")
+	}
+}
+
+// rememberChatExpiration keeps track of the timer of a chat from the
+// messages in it: timer changes and the expiration of ephemeral messages
+func rememberChatExpiration(db *sqlx.DB, resolver *JIDResolver, userID int, evt *events.Message) {
+	if evt.Info.Chat == types.StatusBroadcastJID || evt.Info.Chat.Server == types.NewsletterServer {
+		return
+	}
+	protocol := evt.Message.GetProtocolMessage()
+	if protocol.GetType() == waProto.ProtocolMessage_EPHEMERAL_SETTING {
+		saveChatExpiration(db, resolver, userID, evt.Info.Chat, protocol.GetEphemeralExpiration())
+		return
+	}
+	if evt.IsEphemeral {
+		inner, _ := unwrapMessage(evt.Message)
+		if expiration := messageContextInfo(inner).GetExpiration(); expiration > 0 {
+			saveChatExpiration(db, resolver, userID, evt.Info.Chat, expiration)
+		}
+	}
+}
+
+// chatExpiration returns the current timer of a chat, so outgoing messages
+// disappear like the rest of the conversation. The timer of groups not seen
+// yet is read from the group info.
+func chatExpiration(db *sqlx.DB, resolver *JIDResolver, cli *whatsmeow.Client, userID int, chat types.JID) uint32 {
+	if expiration, ok := loadChatExpiration(db, resolver, userID, chat); ok {
+		return expiration
+	}
+	if chat.Server != types.GroupServer || cli == nil {
+		return 0
+	}
+	info, err := cli.GetGroupInfo(chat)
+	if err != nil {
+		log.Warn().Err(err).Str("group", chat.String()).Msg("Could not get group disappearing timer")
+		return 0
+	}
+	var expiration uint32
+	if info.IsEphemeral {
+		expiration = info.DisappearingTimer
+	}
+	saveChatExpiration(db, resolver, userID, chat, expiration)
+	return expiration
+}
+
+// chatExpiration returns the timer of a chat, see chatExpiration
+func (s *server) chatExpiration(cli *whatsmeow.Client, userID int, chat types.JID) uint32 {
+	return chatExpiration(s.db, s.resolver, cli, userID, chat)
+}
+
+// applyChatExpiration sets the timer on messages that are not built with
+// applyContextInfo: buttons, lists, interactive messages and reactions.
+// Reactions have no ContextInfo and expire as an add-on of the message.
+func applyChatExpiration(msg *waProto.Message, expiration uint32) {
+	if expiration == 0 {
+		return
+	}
+	inner, _ := unwrapMessage(msg)
+	if inner.ReactionMessage != nil {
+		msg.MessageContextInfo = &waProto.MessageContextInfo{
+			MessageAddOnDurationInSecs: proto.Uint32(expiration),
+			MessageAddOnExpiryType:     waE2E.MessageContextInfo_STATIC.Enum(),
+		}
+		return
+	}
+
+	var contextInfo *waProto.ContextInfo
+	switch {
+	case inner.ButtonsMessage != nil:
+		if inner.ButtonsMessage.ContextInfo == nil {
+			inner.ButtonsMessage.ContextInfo = &waProto.ContextInfo{}
+		}
+		contextInfo = inner.ButtonsMessage.ContextInfo
+	case inner.ListMessage != nil:
+		if inner.ListMessage.ContextInfo == nil {
+			inner.ListMessage.ContextInfo = &waProto.ContextInfo{}
+		}
+		contextInfo = inner.ListMessage.ContextInfo
+	case inner.InteractiveMessage != nil:
+		if inner.InteractiveMessage.ContextInfo == nil {
+			inner.InteractiveMessage.ContextInfo = &waProto.ContextInfo{}
+		}
+		contextInfo = inner.InteractiveMessage.ContextInfo
+	default:
+		contextInfo = contextInfoFor(inner)
+	}
+	if contextInfo != nil {
+		contextInfo.Expiration = proto.Uint32(expiration)
+	}
+}
+
+// viewOnceMessage marks image, video and audio messages as view once and
+// wraps them like the official clients do. Other messages are returned as is.
+func viewOnceMessage(msg *waProto.Message) *waProto.Message {
+	switch {
+	case msg.ImageMessage != nil:
+		msg.ImageMessage.ViewOnce = proto.Bool(true)
+	case msg.VideoMessage != nil:
+		msg.VideoMessage.ViewOnce = proto.Bool(true)
+	case msg.AudioMessage != nil:
+		msg.AudioMessage.ViewOnce = proto.Bool(true)
+		return &waProto.Message{ViewOnceMessageV2Extension: &waProto.FutureProofMessage{Message: msg}}
+	default:
+		return msg
+	}
+	return &waProto.Message{ViewOnceMessageV2: &waProto.FutureProofMessage{Message: msg}}
+}
+
+// Sets the disappearing messages timer of a chat. Duration accepts off, 24h,
+// 7d and 90d, the only values WhatsApp clients support.
+func (s *server) SetDisappearingTimer() http.HandlerFunc {
+
+	type disappearingStruct struct {
+		Phone    string
+		Duration string
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+		userid, _ := strconv.Atoi(txtid)
+
+		cli := clientPointer[userid]
+		if cli == nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New("No session"))
+			return
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		var t disappearingStruct
+		err := decoder.Decode(&t)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Could not decode Payload"))
+			return
+		}
+
+		if t.Phone == "" {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Missing Phone in Payload"))
+			return
+		}
+
+		timer, ok := whatsmeow.ParseDisappearingTimerString(t.Duration)
+		if !ok {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Invalid Duration, must be off, 24h, 7d or 90d"))
+			return
+		}
+
+		recipient, err := s.resolveRecipient(cli, t.Phone)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		err = cli.SetDisappearingTimer(recipient, timer)
+		if err != nil {
+			log.Error().Str("error", fmt.Sprintf("%v", err)).Msg("Failed to set disappearing timer")
+			msg := fmt.Sprintf("Failed to set disappearing timer: %v", err)
+			s.Respond(w, r, http.StatusInternalServerError, msg)
+			return
+		}
+		saveChatExpiration(s.db, s.resolver, userid, recipient, uint32(timer/time.Second))
+
+		response := map[string]interface{}{"Details": "Disappearing timer set", "Expiration": uint32(timer / time.Second)}
+		responseJson, err := json.Marshal(response)
+
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+		} else {
+			s.Respond(w, r, http.StatusOK, string(responseJson))
+		}
+
+		return
+	}
+}
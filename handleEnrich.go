@@ -0,0 +1,394 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/patrickmn/go-cache"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Enrichment job states
+const (
+	enrichQueued  = "queued"
+	enrichRunning = "running"
+	enrichDone    = "done"
+	enrichFailed  = "failed"
+)
+
+// Finished jobs are kept in memory for a day after they finish. Queued and
+// running jobs never expire.
+var enrichJobs = cache.New(24*time.Hour, time.Hour)
+
+// Only one job runs at a time per user, so all requests of a session to
+// WhatsApp share the same pacing. Other jobs wait in the queue.
+var enrichQueue = struct {
+	sync.Mutex
+	running map[int]bool
+	pending map[int][]*enrichJob
+}{running: make(map[int]bool), pending: make(map[int][]*enrichJob)}
+
+type enrichConfig struct {
+	concurrency int
+	rate        time.Duration // interval between requests to WhatsApp
+	batchSize   int
+	maxPhones   int
+}
+
+// Configuration from ENRICH_CONCURRENCY (default 4), ENRICH_RATE (requests
+// per second, default 5), ENRICH_BATCH_SIZE (default 50) and
+// ENRICH_MAX_PHONES (default 100000)
+func loadEnrichConfig() enrichConfig {
+	config := enrichConfig{concurrency: 4, rate: 200 * time.Millisecond, batchSize: 50, maxPhones: 100000}
+	if v, err := strconv.Atoi(os.Getenv("ENRICH_CONCURRENCY")); err == nil && v > 0 {
+		config.concurrency = v
+	}
+	if v, err := strconv.ParseFloat(os.Getenv("ENRICH_RATE"), 64); err == nil && v > 0 {
+		config.rate = time.Duration(float64(time.Second) / v)
+	}
+	if v, err := strconv.Atoi(os.Getenv("ENRICH_BATCH_SIZE")); err == nil && v > 0 {
+		config.batchSize = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("ENRICH_MAX_PHONES")); err == nil && v > 0 {
+		config.maxPhones = v
+	}
+	return config
+}
+
+type enrichResult struct {
+	Phone        string
+	JID          string
+	IsIn         bool
+	VerifiedName string
+	Status       string
+	PictureID    string
+	AvatarURL    string
+	Error        string `json:",omitempty"`
+}
+
+type enrichJob struct {
+	sync.Mutex
+	ID         string
+	UserID     int `json:"-"`
+	Status     string
+	Error      string `json:",omitempty"`
+	Total      int
+	Processed  int
+	CreatedAt  time.Time
+	FinishedAt *time.Time `json:",omitempty"`
+	Results    []enrichResult
+	config     enrichConfig
+}
+
+func newJobID() string {
+	id := make([]byte, 12)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+func (job *enrichJob) finish(status string, err error) {
+	job.Lock()
+	defer job.Unlock()
+	now := time.Now()
+	job.Status = status
+	job.FinishedAt = &now
+	if err != nil {
+		job.Error = err.Error()
+	}
+	// the day starts counting when the job finishes
+	enrichJobs.Set(job.ID, job, cache.DefaultExpiration)
+}
+
+// enqueue starts the job, or queues it when the user already has a job running
+func (job *enrichJob) enqueue() {
+	enrichQueue.Lock()
+	defer enrichQueue.Unlock()
+	if enrichQueue.running[job.UserID] {
+		enrichQueue.pending[job.UserID] = append(enrichQueue.pending[job.UserID], job)
+		return
+	}
+	enrichQueue.running[job.UserID] = true
+	go runEnrichJobs(job)
+}
+
+// runEnrichJobs runs the job and then the ones queued by the same user
+func runEnrichJobs(job *enrichJob) {
+	userID := job.UserID
+	for job != nil {
+		job.run(job.config)
+
+		enrichQueue.Lock()
+		job = nil
+		if pending := enrichQueue.pending[userID]; len(pending) > 0 {
+			job = pending[0]
+			enrichQueue.pending[userID] = pending[1:]
+		} else {
+			delete(enrichQueue.running, userID)
+			delete(enrichQueue.pending, userID)
+		}
+		enrichQueue.Unlock()
+	}
+}
+
+// run checks the phones in batches with IsOnWhatsApp and GetUserInfo, then
+// fetches the profile pictures with a bounded number of workers. All calls
+// to WhatsApp share the same pacing, and only one job runs per user.
+func (job *enrichJob) run(config enrichConfig) {
+	job.Lock()
+	job.Status = enrichRunning
+	job.Unlock()
+
+	pacer := time.NewTicker(config.rate)
+	defer pacer.Stop()
+
+	for start := 0; start < job.Total; start += config.batchSize {
+		end := start + config.batchSize
+		if end > job.Total {
+			end = job.Total
+		}
+
+		cli := clientPointer[job.UserID]
+		if cli == nil || !cli.IsConnected() {
+			job.finish(enrichFailed, errors.New("Session disconnected"))
+			return
+		}
+
+		batch := job.Results[start:end]
+		queries := make([]string, len(batch))
+		for i := range batch {
+			queries[i] = "+" + batch[i].Phone
+		}
+
+		<-pacer.C
+		resp, err := cli.IsOnWhatsApp(queries)
+		if err != nil {
+			log.Warn().Err(err).Str("job", job.ID).Msg("Enrichment batch failed")
+			job.Lock()
+			for i := range batch {
+				batch[i].Error = fmt.Sprintf("IsOnWhatsApp failed: %v", err)
+			}
+			job.Processed = end
+			job.Unlock()
+			continue
+		}
+
+		registered := make([]types.JID, 0, len(batch))
+		byQuery := make(map[string]types.IsOnWhatsAppResponse, len(resp))
+		for _, status := range resp {
+			byQuery[strings.TrimPrefix(status.Query, "+")] = status
+		}
+		job.Lock()
+		for i := range batch {
+			status, ok := byQuery[batch[i].Phone]
+			if !ok {
+				continue
+			}
+			batch[i].JID = status.JID.String()
+			batch[i].IsIn = status.IsIn
+			if status.VerifiedName != nil && status.VerifiedName.Details != nil {
+				batch[i].VerifiedName = status.VerifiedName.Details.GetVerifiedName()
+			}
+			if status.IsIn {
+				registered = append(registered, status.JID)
+			}
+		}
+		job.Unlock()
+
+		if len(registered) > 0 {
+			<-pacer.C
+			info, err := cli.GetUserInfo(registered)
+			if err != nil {
+				log.Warn().Err(err).Str("job", job.ID).Msg("Enrichment user info failed")
+			}
+			job.Lock()
+			for i := range batch {
+				if !batch[i].IsIn {
+					continue
+				}
+				if err != nil {
+					batch[i].Error = fmt.Sprintf("GetUserInfo failed: %v", err)
+					continue
+				}
+				jid, _ := types.ParseJID(batch[i].JID)
+				if user, ok := info[jid]; ok {
+					batch[i].Status = user.Status
+					batch[i].PictureID = user.PictureID
+				}
+			}
+			job.Unlock()
+			job.fetchAvatars(cli, batch, config.concurrency, pacer.C)
+		}
+
+		job.Lock()
+		job.Processed = end
+		job.Unlock()
+	}
+
+	job.finish(enrichDone, nil)
+	log.Info().Str("job", job.ID).Int("total", job.Total).Msg("Enrichment job finished")
+}
+
+func (job *enrichJob) fetchAvatars(cli *whatsmeow.Client, batch []enrichResult, concurrency int, pace <-chan time.Time) {
+	pending := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range pending {
+				jid, err := types.ParseJID(batch[i].JID)
+				if err != nil {
+					continue
+				}
+				<-pace
+				pic, err := cli.GetProfilePictureInfo(jid, &whatsmeow.GetProfilePictureParams{})
+				if err != nil && !errors.Is(err, whatsmeow.ErrProfilePictureNotSet) && !errors.Is(err, whatsmeow.ErrProfilePictureUnauthorized) {
+					job.Lock()
+					batch[i].Error = fmt.Sprintf("GetProfilePictureInfo failed: %v", err)
+					job.Unlock()
+					continue
+				}
+				if pic == nil {
+					continue
+				}
+				job.Lock()
+				batch[i].AvatarURL = pic.URL
+				job.Unlock()
+			}
+		}()
+	}
+	for i := range batch {
+		if batch[i].IsIn && batch[i].PictureID != "" {
+			pending <- i
+		}
+	}
+	close(pending)
+	wg.Wait()
+}
+
+// Starts a bulk enrichment job
+func (s *server) StartEnrichment() http.HandlerFunc {
+
+	type enrichStruct struct {
+		Phone []string
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+		userid, _ := strconv.Atoi(txtid)
+
+		if clientPointer[userid] == nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New("No session"))
+			return
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		var t enrichStruct
+		err := decoder.Decode(&t)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Could not decode Payload"))
+			return
+		}
+
+		config := loadEnrichConfig()
+		seen := make(map[string]bool, len(t.Phone))
+		results := make([]enrichResult, 0, len(t.Phone))
+		for _, phone := range t.Phone {
+			phone = onlyDigits(phone)
+			if phone == "" || seen[phone] {
+				continue
+			}
+			seen[phone] = true
+			results = append(results, enrichResult{Phone: phone})
+		}
+		if len(results) == 0 {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Missing Phone in Payload"))
+			return
+		}
+		if len(results) > config.maxPhones {
+			s.Respond(w, r, http.StatusBadRequest, fmt.Errorf("Too many phones, the limit is %d per job", config.maxPhones))
+			return
+		}
+
+		job := &enrichJob{
+			ID:        newJobID(),
+			UserID:    userid,
+			Status:    enrichQueued,
+			Total:     len(results),
+			CreatedAt: time.Now(),
+			Results:   results,
+			config:    config,
+		}
+		enrichJobs.Set(job.ID, job, cache.NoExpiration)
+		job.enqueue()
+
+		log.Info().Str("job", job.ID).Int("total", job.Total).Msg("Enrichment job started")
+		response := map[string]interface{}{"Id": job.ID, "Status": job.Status, "Total": job.Total}
+		responseJson, err := json.Marshal(response)
+
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+		} else {
+			s.Respond(w, r, http.StatusOK, string(responseJson))
+		}
+
+		return
+	}
+}
+
+// Gets the status and results of an enrichment job, as JSON or CSV
+func (s *server) GetEnrichment() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+		userid, _ := strconv.Atoi(txtid)
+
+		cached, found := enrichJobs.Get(mux.Vars(r)["id"])
+		if !found || cached.(*enrichJob).UserID != userid {
+			s.Respond(w, r, http.StatusNotFound, errors.New("Job not found"))
+			return
+		}
+		job := cached.(*enrichJob)
+
+		job.Lock()
+		defer job.Unlock()
+
+		if r.URL.Query().Get("format") == "csv" || strings.Contains(r.Header.Get("Accept"), "text/csv") {
+			w.Header().Set("Content-Type", "text/csv")
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=enrich-%s.csv", job.ID))
+			w.Header().Set("X-Job-Status", job.Status)
+			writer := csv.NewWriter(w)
+			writer.Write([]string{"phone", "jid", "is_in", "verified_name", "status", "picture_id", "avatar_url", "error"})
+			for _, result := range job.Results {
+				writer.Write([]string{result.Phone, result.JID, strconv.FormatBool(result.IsIn), result.VerifiedName,
+					result.Status, result.PictureID, result.AvatarURL, result.Error})
+			}
+			writer.Flush()
+			return
+		}
+
+		responseJson, err := json.Marshal(job)
+
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+		} else {
+			s.Respond(w, r, http.StatusOK, string(responseJson))
+		}
+
+		return
+	}
+}
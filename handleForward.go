@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"google.golang.org/protobuf/proto"
+)
+
+// Media of older messages may already be gone from the WhatsApp servers, so
+// it is downloaded and uploaded again instead of reusing the reference
+const forwardMediaReuseAge = 7 * 24 * time.Hour
+
+// forwardMessage returns a copy of a stored message ready to be forwarded:
+// unwrapped, without its quote and mentions, and marked as forwarded
+func forwardMessage(stored *waProto.Message) (*waProto.Message, error) {
+	inner, wrappers := unwrapMessage(stored)
+	if wrappers.ViewOnce || inner.GetImageMessage().GetViewOnce() || inner.GetVideoMessage().GetViewOnce() || inner.GetAudioMessage().GetViewOnce() {
+		return nil, errors.New("View once messages cannot be forwarded")
+	}
+
+	msg := proto.Clone(inner).(*waProto.Message)
+	// text without formatting has no ContextInfo to carry the forwarded flag
+	if msg.Conversation != nil {
+		msg = &waProto.Message{ExtendedTextMessage: &waProto.ExtendedTextMessage{Text: msg.Conversation}}
+	}
+	msg.MessageContextInfo = nil
+
+	contextInfo := contextInfoFor(msg)
+	if contextInfo == nil {
+		return nil, fmt.Errorf("Messages of type %s cannot be forwarded", storedMessageType(stored))
+	}
+	score := contextInfo.GetForwardingScore() + 1
+	proto.Reset(contextInfo)
+	contextInfo.IsForwarded = proto.Bool(true)
+	contextInfo.ForwardingScore = proto.Uint32(score)
+	return msg, nil
+}
+
+// reuploadMedia downloads the media of a message and uploads it again,
+// replacing the reference to the original file
+func reuploadMedia(ctx context.Context, cli *whatsmeow.Client, msg *waProto.Message) error {
+	var media whatsmeow.DownloadableMessage
+	switch {
+	case msg.ImageMessage != nil:
+		media = msg.ImageMessage
+	case msg.VideoMessage != nil:
+		media = msg.VideoMessage
+	case msg.AudioMessage != nil:
+		media = msg.AudioMessage
+	case msg.DocumentMessage != nil:
+		media = msg.DocumentMessage
+	case msg.StickerMessage != nil:
+		media = msg.StickerMessage
+	default:
+		return nil
+	}
+
+	data, err := cli.Download(media)
+	if err != nil {
+		return fmt.Errorf("Media of the original message is no longer available: %v", err)
+	}
+	uploaded, err := cli.Upload(ctx, data, whatsmeow.GetMediaType(media))
+	if err != nil {
+		return fmt.Errorf("Failed to upload file: %v", err)
+	}
+
+	switch m := media.(type) {
+	case *waProto.ImageMessage:
+		m.URL, m.DirectPath, m.MediaKey = proto.String(uploaded.URL), proto.String(uploaded.DirectPath), uploaded.MediaKey
+		m.FileEncSHA256, m.FileSHA256, m.FileLength = uploaded.FileEncSHA256, uploaded.FileSHA256, proto.Uint64(uploaded.FileLength)
+		m.MediaKeyTimestamp = proto.Int64(time.Now().Unix())
+	case *waProto.VideoMessage:
+		m.URL, m.DirectPath, m.MediaKey = proto.String(uploaded.URL), proto.String(uploaded.DirectPath), uploaded.MediaKey
+		m.FileEncSHA256, m.FileSHA256, m.FileLength = uploaded.FileEncSHA256, uploaded.FileSHA256, proto.Uint64(uploaded.FileLength)
+		m.MediaKeyTimestamp = proto.Int64(time.Now().Unix())
+	case *waProto.AudioMessage:
+		m.URL, m.DirectPath, m.MediaKey = proto.String(uploaded.URL), proto.String(uploaded.DirectPath), uploaded.MediaKey
+		m.FileEncSHA256, m.FileSHA256, m.FileLength = uploaded.FileEncSHA256, uploaded.FileSHA256, proto.Uint64(uploaded.FileLength)
+		m.MediaKeyTimestamp = proto.Int64(time.Now().Unix())
+	case *waProto.DocumentMessage:
+		m.URL, m.DirectPath, m.MediaKey = proto.String(uploaded.URL), proto.String(uploaded.DirectPath), uploaded.MediaKey
+		m.FileEncSHA256, m.FileSHA256, m.FileLength = uploaded.FileEncSHA256, uploaded.FileSHA256, proto.Uint64(uploaded.FileLength)
+		m.MediaKeyTimestamp = proto.Int64(time.Now().Unix())
+	case *waProto.StickerMessage:
+		m.URL, m.DirectPath, m.MediaKey = proto.String(uploaded.URL), proto.String(uploaded.DirectPath), uploaded.MediaKey
+		m.FileEncSHA256, m.FileSHA256, m.FileLength = uploaded.FileEncSHA256, uploaded.FileSHA256, proto.Uint64(uploaded.FileLength)
+		m.MediaKeyTimestamp = proto.Int64(time.Now().Unix())
+	}
+	return nil
+}
+
+// Forwards a stored message to one or more chats. Media is sent by reference
+// to the original file when it is recent enough, without uploading it again.
+func (s *server) ForwardMessage() http.HandlerFunc {
+
+	type forwardStruct struct {
+		// chat where the original message was sent or received
+		From string
+		Id   string
+		To   []string
+	}
+
+	type forwardResult struct {
+		Phone     string
+		Id        string     `json:",omitempty"`
+		Timestamp *time.Time `json:",omitempty"`
+		Error     string     `json:",omitempty"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+		userid, _ := strconv.Atoi(txtid)
+
+		cli := clientPointer[userid]
+		if cli == nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New("No session"))
+			return
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		var t forwardStruct
+		err := decoder.Decode(&t)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Could not decode Payload"))
+			return
+		}
+
+		if t.From == "" {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Missing From in Payload"))
+			return
+		}
+
+		if t.Id == "" {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Missing Id in Payload"))
+			return
+		}
+
+		if len(t.To) < 1 {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Missing To in Payload"))
+			return
+		}
+
+		source, err := s.resolveRecipient(cli, t.From)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		stored, err := s.messages.Get(userid, source, t.Id)
+		if err != nil {
+			s.Respond(w, r, http.StatusNotFound, errors.New("Message not found"))
+			return
+		}
+		original, err := stored.Decode()
+		if err != nil {
+			log.Error().Str("error", fmt.Sprintf("%v", err)).Msg("Failed to decode stored message")
+			s.Respond(w, r, http.StatusInternalServerError, errors.New("Failed to decode stored message"))
+			return
+		}
+
+		msg, err := forwardMessage(original)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, err)
+			return
+		}
+		if time.Since(stored.Timestamp) > forwardMediaReuseAge {
+			err = reuploadMedia(r.Context(), cli, msg)
+			if err != nil {
+				log.Error().Str("error", fmt.Sprintf("%v", err)).Str("id", t.Id).Msg("Failed to reupload forwarded media")
+				s.Respond(w, r, http.StatusInternalServerError, err)
+				return
+			}
+		}
+
+		results := []forwardResult{}
+		sent := 0
+		for _, phone := range t.To {
+			result := forwardResult{Phone: phone}
+			recipient, err := s.resolveRecipient(cli, phone)
+			if err != nil {
+				result.Error = err.Error()
+				results = append(results, result)
+				continue
+			}
+
+			// each chat may have its own disappearing timer
+			out := proto.Clone(msg).(*waProto.Message)
+			applyChatExpiration(out, s.chatExpiration(cli, userid, recipient))
+
+			msgid := cli.GenerateMessageID()
+			resp, err := cli.SendMessage(context.Background(), recipient, out, whatsmeow.SendRequestExtra{ID: msgid})
+			if err != nil {
+				log.Error().Str("error", fmt.Sprintf("%v", err)).Str("to", recipient.String()).Msg("Failed to forward message")
+				result.Error = fmt.Sprintf("Failed to forward message: %v", err)
+				results = append(results, result)
+				continue
+			}
+			s.messages.SaveSent(userid, cli, recipient, resp, out)
+			log.Info().Str("timestamp", fmt.Sprintf("%v", resp.Timestamp)).Str("id", msgid).Str("to", recipient.String()).Msg("Message forwarded")
+
+			result.Id = msgid
+			result.Timestamp = &resp.Timestamp
+			results = append(results, result)
+			sent++
+		}
+
+		status := http.StatusOK
+		if sent == 0 {
+			status = http.StatusInternalServerError
+		}
+		response := map[string]interface{}{"Details": fmt.Sprintf("Forwarded to %d of %d chats", sent, len(t.To)), "Results": results}
+		responseJson, err := json.Marshal(response)
+
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+		} else {
+			s.Respond(w, r, status, string(responseJson))
+		}
+
+		return
+	}
+}
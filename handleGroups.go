@@ -0,0 +1,851 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Result of a participant change, one entry per requested participant
+type participantResult struct {
+	JID              string
+	Success          bool
+	Code             int
+	Status           string
+	InviteCode       string `json:",omitempty"`
+	InviteExpiration int64  `json:",omitempty"`
+}
+
+// Error codes returned by WhatsApp on participant changes
+var participantStatus = map[int]string{
+	200: "success",
+	400: "bad request",
+	401: "not authorized",
+	403: "not allowed, an invite request was generated",
+	404: "not found",
+	406: "not acceptable",
+	408: "participant recently left the group",
+	409: "participant already in group",
+	500: "internal server error",
+}
+
+func newParticipantResults(participants []types.GroupParticipant) []participantResult {
+	results := make([]participantResult, 0, len(participants))
+	for _, p := range participants {
+		code := p.Error
+		if code == 0 {
+			code = 200
+		}
+		status, ok := participantStatus[code]
+		if !ok {
+			status = "error " + strconv.Itoa(code)
+		}
+		result := participantResult{
+			JID:     p.JID.String(),
+			Success: code == 200,
+			Code:    code,
+			Status:  status,
+		}
+		if p.AddRequest != nil {
+			result.InviteCode = p.AddRequest.Code
+			result.InviteExpiration = p.AddRequest.Expiration.Unix()
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// resolveParticipants resolves a list of phone numbers or JIDs like the
+// recipients of messages, so numbers are checked and LIDs mapped
+func (s *server) resolveParticipants(cli *whatsmeow.Client, phones []string) ([]types.JID, error) {
+	jids := make([]types.JID, 0, len(phones))
+	for _, phone := range phones {
+		phone = strings.TrimSpace(phone)
+		if phone == "" {
+			continue
+		}
+		jid, err := s.resolveRecipient(cli, phone)
+		if err != nil {
+			return nil, fmt.Errorf("Could not resolve Phone %s: %v", phone, err)
+		}
+		jids = append(jids, jid)
+	}
+	if len(jids) == 0 {
+		return nil, errors.New("Missing Phone in Payload")
+	}
+	return jids, nil
+}
+
+// parseGroupJID parses the GroupJID field sent on group payloads
+func parseGroupJID(groupJID string) (types.JID, error) {
+	if groupJID == "" {
+		return types.JID{}, errors.New("Missing GroupJID in Payload")
+	}
+	group, ok := parseJID(groupJID)
+	if !ok {
+		return types.JID{}, errors.New("Could not parse Group JID")
+	}
+	return group, nil
+}
+
+// Create group
+func (s *server) CreateGroup() http.HandlerFunc {
+
+	type createGroupStruct struct {
+		Name         string
+		Participants []string
+		CommunityJID string // optional, creates the group inside a community
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+		userid, _ := strconv.Atoi(txtid)
+
+		if clientPointer[userid] == nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New("No session"))
+			return
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		var t createGroupStruct
+		err := decoder.Decode(&t)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Could not decode Payload"))
+			return
+		}
+
+		if t.Name == "" {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Missing Name in Payload"))
+			return
+		}
+
+		participants, err := s.resolveParticipants(clientPointer[userid], t.Participants)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		req := whatsmeow.ReqCreateGroup{
+			Name:         t.Name,
+			Participants: participants,
+		}
+		if t.CommunityJID != "" {
+			community, err := parseCommunityJID(t.CommunityJID)
+			if err != nil {
+				s.Respond(w, r, http.StatusBadRequest, err)
+				return
+			}
+			req.LinkedParentJID = community
+		}
+
+		info, err := clientPointer[userid].CreateGroup(req)
+		if err != nil {
+			log.Error().Str("error", fmt.Sprintf("%v", err)).Msg("Failed to create group")
+			msg := fmt.Sprintf("Failed to create group: %v", err)
+			s.Respond(w, r, http.StatusInternalServerError, msg)
+			return
+		}
+
+		response := map[string]interface{}{
+			"GroupInfo":    info,
+			"Participants": newParticipantResults(info.Participants),
+		}
+		responseJson, err := json.Marshal(response)
+
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+		} else {
+			s.Respond(w, r, http.StatusOK, string(responseJson))
+		}
+
+		return
+	}
+}
+
+// Add, remove, promote or demote group participants
+func (s *server) UpdateGroupParticipants() http.HandlerFunc {
+
+	type updateParticipantsStruct struct {
+		GroupJID string
+		Phone    []string
+		Action   string
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+		userid, _ := strconv.Atoi(txtid)
+
+		if clientPointer[userid] == nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New("No session"))
+			return
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		var t updateParticipantsStruct
+		err := decoder.Decode(&t)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Could not decode Payload"))
+			return
+		}
+
+		group, err := parseGroupJID(t.GroupJID)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		var action whatsmeow.ParticipantChange
+		switch strings.ToLower(t.Action) {
+		case "add":
+			action = whatsmeow.ParticipantChangeAdd
+		case "remove":
+			action = whatsmeow.ParticipantChangeRemove
+		case "promote":
+			action = whatsmeow.ParticipantChangePromote
+		case "demote":
+			action = whatsmeow.ParticipantChangeDemote
+		default:
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Invalid Action, must be add, remove, promote or demote"))
+			return
+		}
+
+		participants, err := s.resolveParticipants(clientPointer[userid], t.Phone)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		resp, err := clientPointer[userid].UpdateGroupParticipants(group, participants, action)
+		if err != nil {
+			log.Error().Str("error", fmt.Sprintf("%v", err)).Msg("Failed to update group participants")
+			msg := fmt.Sprintf("Failed to update group participants: %v", err)
+			s.Respond(w, r, http.StatusInternalServerError, msg)
+			return
+		}
+
+		response := map[string]interface{}{"Participants": newParticipantResults(resp)}
+		responseJson, err := json.Marshal(response)
+
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+		} else {
+			s.Respond(w, r, http.StatusOK, string(responseJson))
+		}
+
+		return
+	}
+}
+
+// Set group topic (description), an empty Topic removes it
+func (s *server) SetGroupTopic() http.HandlerFunc {
+
+	type setGroupTopicStruct struct {
+		GroupJID string
+		Topic    string
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+		userid, _ := strconv.Atoi(txtid)
+
+		if clientPointer[userid] == nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New("No session"))
+			return
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		var t setGroupTopicStruct
+		err := decoder.Decode(&t)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Could not decode Payload"))
+			return
+		}
+
+		group, err := parseGroupJID(t.GroupJID)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		err = clientPointer[userid].SetGroupTopic(group, "", "", t.Topic)
+		if err != nil {
+			log.Error().Str("error", fmt.Sprintf("%v", err)).Msg("Failed to set group topic")
+			msg := fmt.Sprintf("Failed to set group topic: %v", err)
+			s.Respond(w, r, http.StatusInternalServerError, msg)
+			return
+		}
+
+		response := map[string]interface{}{"Details": "Group Topic set successfully"}
+		responseJson, err := json.Marshal(response)
+
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+		} else {
+			s.Respond(w, r, http.StatusOK, string(responseJson))
+		}
+
+		return
+	}
+}
+
+// Leave group
+func (s *server) LeaveGroup() http.HandlerFunc {
+
+	type leaveGroupStruct struct {
+		GroupJID string
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+		userid, _ := strconv.Atoi(txtid)
+
+		if clientPointer[userid] == nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New("No session"))
+			return
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		var t leaveGroupStruct
+		err := decoder.Decode(&t)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Could not decode Payload"))
+			return
+		}
+
+		group, err := parseGroupJID(t.GroupJID)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		err = clientPointer[userid].LeaveGroup(group)
+		if err != nil {
+			log.Error().Str("error", fmt.Sprintf("%v", err)).Msg("Failed to leave group")
+			msg := fmt.Sprintf("Failed to leave group: %v", err)
+			s.Respond(w, r, http.StatusInternalServerError, msg)
+			return
+		}
+
+		response := map[string]interface{}{"Details": "Left group successfully"}
+		responseJson, err := json.Marshal(response)
+
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+		} else {
+			s.Respond(w, r, http.StatusOK, string(responseJson))
+		}
+
+		return
+	}
+}
+
+// Set group announce mode (only admins can send messages)
+func (s *server) SetGroupAnnounce() http.HandlerFunc {
+
+	type setGroupAnnounceStruct struct {
+		GroupJID string
+		Announce bool
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+		userid, _ := strconv.Atoi(txtid)
+
+		if clientPointer[userid] == nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New("No session"))
+			return
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		var t setGroupAnnounceStruct
+		err := decoder.Decode(&t)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Could not decode Payload"))
+			return
+		}
+
+		group, err := parseGroupJID(t.GroupJID)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		err = clientPointer[userid].SetGroupAnnounce(group, t.Announce)
+		if err != nil {
+			log.Error().Str("error", fmt.Sprintf("%v", err)).Msg("Failed to set group announce mode")
+			msg := fmt.Sprintf("Failed to set group announce mode: %v", err)
+			s.Respond(w, r, http.StatusInternalServerError, msg)
+			return
+		}
+
+		response := map[string]interface{}{"Details": "Group Announce set successfully"}
+		responseJson, err := json.Marshal(response)
+
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+		} else {
+			s.Respond(w, r, http.StatusOK, string(responseJson))
+		}
+
+		return
+	}
+}
+
+// Set group locked mode (only admins can edit group info)
+func (s *server) SetGroupLocked() http.HandlerFunc {
+
+	type setGroupLockedStruct struct {
+		GroupJID string
+		Locked   bool
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+		userid, _ := strconv.Atoi(txtid)
+
+		if clientPointer[userid] == nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New("No session"))
+			return
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		var t setGroupLockedStruct
+		err := decoder.Decode(&t)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Could not decode Payload"))
+			return
+		}
+
+		group, err := parseGroupJID(t.GroupJID)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		err = clientPointer[userid].SetGroupLocked(group, t.Locked)
+		if err != nil {
+			log.Error().Str("error", fmt.Sprintf("%v", err)).Msg("Failed to set group locked mode")
+			msg := fmt.Sprintf("Failed to set group locked mode: %v", err)
+			s.Respond(w, r, http.StatusInternalServerError, msg)
+			return
+		}
+
+		response := map[string]interface{}{"Details": "Group Locked set successfully"}
+		responseJson, err := json.Marshal(response)
+
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+		} else {
+			s.Respond(w, r, http.StatusOK, string(responseJson))
+		}
+
+		return
+	}
+}
+
+// Set group disappearing messages timer
+func (s *server) SetGroupDisappearing() http.HandlerFunc {
+
+	type setGroupDisappearingStruct struct {
+		GroupJID string
+		Duration string
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+		userid, _ := strconv.Atoi(txtid)
+
+		if clientPointer[userid] == nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New("No session"))
+			return
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		var t setGroupDisappearingStruct
+		err := decoder.Decode(&t)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Could not decode Payload"))
+			return
+		}
+
+		group, err := parseGroupJID(t.GroupJID)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		duration, ok := whatsmeow.ParseDisappearingTimerString(t.Duration)
+		if !ok {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Invalid Duration, must be off, 24h, 7d or 90d"))
+			return
+		}
+
+		err = clientPointer[userid].SetDisappearingTimer(group, duration)
+		if err != nil {
+			log.Error().Str("error", fmt.Sprintf("%v", err)).Msg("Failed to set group disappearing timer")
+			msg := fmt.Sprintf("Failed to set group disappearing timer: %v", err)
+			s.Respond(w, r, http.StatusInternalServerError, msg)
+			return
+		}
+
+		response := map[string]interface{}{"Details": "Group Disappearing timer set successfully", "Seconds": int64(duration / time.Second)}
+		responseJson, err := json.Marshal(response)
+
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+		} else {
+			s.Respond(w, r, http.StatusOK, string(responseJson))
+		}
+
+		return
+	}
+}
+
+// Revoke group invite link and return the new one
+func (s *server) RevokeGroupInviteLink() http.HandlerFunc {
+
+	type revokeInviteLinkStruct struct {
+		GroupJID string
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+		userid, _ := strconv.Atoi(txtid)
+
+		if clientPointer[userid] == nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New("No session"))
+			return
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		var t revokeInviteLinkStruct
+		err := decoder.Decode(&t)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Could not decode Payload"))
+			return
+		}
+
+		group, err := parseGroupJID(t.GroupJID)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		resp, err := clientPointer[userid].GetGroupInviteLink(group, true)
+		if err != nil {
+			log.Error().Str("error", fmt.Sprintf("%v", err)).Msg("Failed to revoke group invite link")
+			msg := fmt.Sprintf("Failed to revoke group invite link: %v", err)
+			s.Respond(w, r, http.StatusInternalServerError, msg)
+			return
+		}
+
+		response := map[string]interface{}{"InviteLink": resp}
+		responseJson, err := json.Marshal(response)
+
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+		} else {
+			s.Respond(w, r, http.StatusOK, string(responseJson))
+		}
+
+		return
+	}
+}
+
+// inviteCode accepts either the invite code or the full invite link
+func inviteCode(code string) string {
+	code = strings.TrimSpace(code)
+	code = strings.TrimPrefix(code, "https://")
+	code = strings.TrimPrefix(code, "http://")
+	code = strings.TrimPrefix(code, "chat.whatsapp.com/")
+	if i := strings.IndexAny(code, "?#/"); i >= 0 {
+		code = code[:i]
+	}
+	return code
+}
+
+// Join group using an invite code or link
+func (s *server) JoinGroup() http.HandlerFunc {
+
+	type joinGroupStruct struct {
+		Code string
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+		userid, _ := strconv.Atoi(txtid)
+
+		if clientPointer[userid] == nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New("No session"))
+			return
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		var t joinGroupStruct
+		err := decoder.Decode(&t)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Could not decode Payload"))
+			return
+		}
+
+		code := inviteCode(t.Code)
+		if code == "" {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Missing Code in Payload"))
+			return
+		}
+
+		group, err := clientPointer[userid].JoinGroupWithLink(code)
+		if err != nil {
+			log.Error().Str("error", fmt.Sprintf("%v", err)).Msg("Failed to join group")
+			msg := fmt.Sprintf("Failed to join group: %v", err)
+			s.Respond(w, r, http.StatusInternalServerError, msg)
+			return
+		}
+
+		response := map[string]interface{}{"Details": "Group joined successfully", "GroupJID": group.String()}
+		responseJson, err := json.Marshal(response)
+
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+		} else {
+			s.Respond(w, r, http.StatusOK, string(responseJson))
+		}
+
+		return
+	}
+}
+
+// Get group information from an invite code or link, without joining
+func (s *server) GetGroupInviteInfo() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+		userid, _ := strconv.Atoi(txtid)
+
+		if clientPointer[userid] == nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New("No session"))
+			return
+		}
+
+		code := inviteCode(r.URL.Query().Get("code"))
+		if code == "" {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Missing code parameter"))
+			return
+		}
+
+		resp, err := clientPointer[userid].GetGroupInfoFromLink(code)
+		if err != nil {
+			log.Error().Str("error", fmt.Sprintf("%v", err)).Msg("Failed to get group invite info")
+			msg := fmt.Sprintf("Failed to get group invite info: %v", err)
+			s.Respond(w, r, http.StatusInternalServerError, msg)
+			return
+		}
+
+		responseJson, err := json.Marshal(resp)
+
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+		} else {
+			s.Respond(w, r, http.StatusOK, string(responseJson))
+		}
+
+		return
+	}
+}
+
+// Set group membership approval mode (admins must approve new members)
+func (s *server) SetGroupApprovalMode() http.HandlerFunc {
+
+	type setGroupApprovalModeStruct struct {
+		GroupJID string
+		Enabled  bool
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+		userid, _ := strconv.Atoi(txtid)
+
+		if clientPointer[userid] == nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New("No session"))
+			return
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		var t setGroupApprovalModeStruct
+		err := decoder.Decode(&t)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Could not decode Payload"))
+			return
+		}
+
+		group, err := parseGroupJID(t.GroupJID)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		err = clientPointer[userid].SetGroupJoinApprovalMode(group, t.Enabled)
+		if err != nil {
+			log.Error().Str("error", fmt.Sprintf("%v", err)).Msg("Failed to set group approval mode")
+			msg := fmt.Sprintf("Failed to set group approval mode: %v", err)
+			s.Respond(w, r, http.StatusInternalServerError, msg)
+			return
+		}
+
+		response := map[string]interface{}{"Details": "Group Approval mode set successfully"}
+		responseJson, err := json.Marshal(response)
+
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+		} else {
+			s.Respond(w, r, http.StatusOK, string(responseJson))
+		}
+
+		return
+	}
+}
+
+// List pending requests to join the group
+func (s *server) ListGroupRequests() http.HandlerFunc {
+
+	type groupRequest struct {
+		JID         string
+		RequestedAt int64
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+		userid, _ := strconv.Atoi(txtid)
+
+		if clientPointer[userid] == nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New("No session"))
+			return
+		}
+
+		groupJID := r.URL.Query().Get("groupJID")
+		if groupJID == "" {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Missing groupJID parameter"))
+			return
+		}
+
+		group, err := parseGroupJID(groupJID)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		resp, err := clientPointer[userid].GetGroupRequestParticipants(group)
+		if err != nil {
+			log.Error().Str("error", fmt.Sprintf("%v", err)).Msg("Failed to get group join requests")
+			msg := fmt.Sprintf("Failed to get group join requests: %v", err)
+			s.Respond(w, r, http.StatusInternalServerError, msg)
+			return
+		}
+
+		requests := make([]groupRequest, 0, len(resp))
+		for _, request := range resp {
+			requests = append(requests, groupRequest{JID: request.JID.String(), RequestedAt: request.RequestedAt.Unix()})
+		}
+
+		response := map[string]interface{}{"Requests": requests}
+		responseJson, err := json.Marshal(response)
+
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+		} else {
+			s.Respond(w, r, http.StatusOK, string(responseJson))
+		}
+
+		return
+	}
+}
+
+// Approve or reject requests to join the group
+func (s *server) UpdateGroupRequests() http.HandlerFunc {
+
+	type updateGroupRequestsStruct struct {
+		GroupJID string
+		Phone    []string
+		Action   string
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+		userid, _ := strconv.Atoi(txtid)
+
+		if clientPointer[userid] == nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New("No session"))
+			return
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		var t updateGroupRequestsStruct
+		err := decoder.Decode(&t)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Could not decode Payload"))
+			return
+		}
+
+		group, err := parseGroupJID(t.GroupJID)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		var action whatsmeow.ParticipantRequestChange
+		switch strings.ToLower(t.Action) {
+		case "approve":
+			action = whatsmeow.ParticipantChangeApprove
+		case "reject":
+			action = whatsmeow.ParticipantChangeReject
+		default:
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Invalid Action, must be approve or reject"))
+			return
+		}
+
+		participants, err := s.resolveParticipants(clientPointer[userid], t.Phone)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		resp, err := clientPointer[userid].UpdateGroupRequestParticipants(group, participants, action)
+		if err != nil {
+			log.Error().Str("error", fmt.Sprintf("%v", err)).Msg("Failed to update group join requests")
+			msg := fmt.Sprintf("Failed to update group join requests: %v", err)
+			s.Respond(w, r, http.StatusInternalServerError, msg)
+			return
+		}
+
+		response := map[string]interface{}{"Participants": newParticipantResults(resp)}
+		responseJson, err := json.Marshal(response)
+
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+		} else {
+			s.Respond(w, r, http.StatusOK, string(responseJson))
+		}
+
+		return
+	}
+}
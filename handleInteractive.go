@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"go.mau.fi/whatsmeow"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"google.golang.org/protobuf/proto"
+)
+
+// Most clients show at most this many native flow buttons
+const maxInteractiveButtons = 10
+
+type interactiveButton struct {
+	Type        string
+	Id          string
+	Text        string
+	URL         string
+	PhoneNumber string
+	Code        string
+}
+
+type interactiveHeader struct {
+	Title    string
+	Subtitle string
+	// image, video or document, sent in Base64 (data URL) or fetched from URL
+	Type     string
+	Base64   string
+	URL      string
+	FileName string
+}
+
+// nativeFlowButton converts a button of the request into a native flow
+// button, whose parameters are sent as JSON
+func nativeFlowButton(button interactiveButton) (*waProto.InteractiveMessage_NativeFlowMessage_NativeFlowButton, error) {
+	if button.Text == "" {
+		return nil, errors.New("Missing Text in button")
+	}
+	params := map[string]string{"display_text": button.Text}
+	name := button.Type
+	switch button.Type {
+	case "quick_reply":
+		if button.Id == "" {
+			return nil, errors.New("Missing Id in quick_reply button")
+		}
+		params["id"] = button.Id
+	case "cta_url":
+		if button.URL == "" {
+			return nil, errors.New("Missing URL in cta_url button")
+		}
+		params["url"] = button.URL
+		params["merchant_url"] = button.URL
+	case "cta_call":
+		if button.PhoneNumber == "" {
+			return nil, errors.New("Missing PhoneNumber in cta_call button")
+		}
+		params["phone_number"] = button.PhoneNumber
+	case "cta_copy":
+		if button.Code == "" {
+			return nil, errors.New("Missing Code in cta_copy button")
+		}
+		params["copy_code"] = button.Code
+		if button.Id != "" {
+			params["id"] = button.Id
+		}
+	default:
+		return nil, fmt.Errorf("Invalid button Type %q, must be quick_reply, cta_url, cta_call or cta_copy", button.Type)
+	}
+	paramsJSON, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	return &waProto.InteractiveMessage_NativeFlowMessage_NativeFlowButton{
+		Name:             proto.String(name),
+		ButtonParamsJSON: proto.String(string(paramsJSON)),
+	}, nil
+}
+
+// buildInteractiveHeader uploads the header media, if any
+func (s *server) buildInteractiveHeader(ctx context.Context, cli *whatsmeow.Client, header interactiveHeader) (*waProto.InteractiveMessage_Header, error) {
+	result := &waProto.InteractiveMessage_Header{
+		Title:    proto.String(header.Title),
+		Subtitle: proto.String(header.Subtitle),
+	}
+	if header.Type == "" {
+		return result, nil
+	}
+
+	filedata, err := statusMediaData(header.Base64, header.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	switch header.Type {
+	case "image":
+		uploaded, err := cli.Upload(ctx, filedata, whatsmeow.MediaImage)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to upload file: %v", err)
+		}
+		thumb, _ := gerarThumbnailImagem(filedata)
+		result.Media = &waProto.InteractiveMessage_Header_ImageMessage{ImageMessage: &waProto.ImageMessage{
+			URL:           proto.String(uploaded.URL),
+			DirectPath:    proto.String(uploaded.DirectPath),
+			MediaKey:      uploaded.MediaKey,
+			Mimetype:      proto.String(http.DetectContentType(filedata)),
+			FileEncSHA256: uploaded.FileEncSHA256,
+			FileSHA256:    uploaded.FileSHA256,
+			FileLength:    proto.Uint64(uint64(len(filedata))),
+			JPEGThumbnail: thumb,
+		}}
+	case "video":
+		video, err := s.transcoder.ToVideo(ctx, filedata)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to convert video: %v", err)
+		}
+		uploaded, err := cli.Upload(ctx, video.Data, whatsmeow.MediaVideo)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to upload file: %v", err)
+		}
+		result.Media = &waProto.InteractiveMessage_Header_VideoMessage{VideoMessage: &waProto.VideoMessage{
+			URL:           proto.String(uploaded.URL),
+			DirectPath:    proto.String(uploaded.DirectPath),
+			MediaKey:      uploaded.MediaKey,
+			Mimetype:      proto.String(video.MimeType),
+			FileEncSHA256: uploaded.FileEncSHA256,
+			FileSHA256:    uploaded.FileSHA256,
+			FileLength:    proto.Uint64(uint64(len(video.Data))),
+			Seconds:       proto.Uint32(audioSeconds(video.Duration)),
+			Width:         proto.Uint32(uint32(video.Width)),
+			Height:        proto.Uint32(uint32(video.Height)),
+		}}
+	case "document":
+		uploaded, err := cli.Upload(ctx, filedata, whatsmeow.MediaDocument)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to upload file: %v", err)
+		}
+		fileName := header.FileName
+		if fileName == "" && header.URL != "" {
+			fileName = filepath.Base(strings.SplitN(header.URL, "?", 2)[0])
+		}
+		result.Media = &waProto.InteractiveMessage_Header_DocumentMessage{DocumentMessage: &waProto.DocumentMessage{
+			URL:           proto.String(uploaded.URL),
+			DirectPath:    proto.String(uploaded.DirectPath),
+			MediaKey:      uploaded.MediaKey,
+			Mimetype:      proto.String(http.DetectContentType(filedata)),
+			FileEncSHA256: uploaded.FileEncSHA256,
+			FileSHA256:    uploaded.FileSHA256,
+			FileLength:    proto.Uint64(uint64(len(filedata))),
+			FileName:      proto.String(fileName),
+			Title:         proto.String(fileName),
+		}}
+	default:
+		return nil, fmt.Errorf("Invalid Header Type %q, must be image, video or document", header.Type)
+	}
+	result.HasMediaAttachment = proto.Bool(true)
+	return result, nil
+}
+
+// Sends an interactive message with native flow buttons: quick replies,
+// links, call and copy code buttons, with an optional header and footer
+func (s *server) SendInteractive() http.HandlerFunc {
+
+	type interactiveStruct struct {
+		Phone   string
+		Body    string
+		Footer  string
+		Header  *interactiveHeader
+		Buttons []interactiveButton
+		Id      string
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+		userid, _ := strconv.Atoi(txtid)
+
+		cli := clientPointer[userid]
+		if cli == nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New("No session"))
+			return
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		var t interactiveStruct
+		err := decoder.Decode(&t)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Could not decode Payload"))
+			return
+		}
+
+		if t.Phone == "" {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Missing Phone in Payload"))
+			return
+		}
+
+		if t.Body == "" {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Missing Body in Payload"))
+			return
+		}
+
+		if len(t.Buttons) < 1 {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Missing Buttons in Payload"))
+			return
+		}
+		if len(t.Buttons) > maxInteractiveButtons {
+			s.Respond(w, r, http.StatusBadRequest, fmt.Errorf("Too many Buttons, the maximum is %d", maxInteractiveButtons))
+			return
+		}
+
+		var buttons []*waProto.InteractiveMessage_NativeFlowMessage_NativeFlowButton
+		for i, item := range t.Buttons {
+			button, err := nativeFlowButton(item)
+			if err != nil {
+				s.Respond(w, r, http.StatusBadRequest, fmt.Errorf("Button %d: %v", i+1, err))
+				return
+			}
+			buttons = append(buttons, button)
+		}
+
+		recipient, err := s.resolveRecipient(cli, t.Phone)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		interactive := &waProto.InteractiveMessage{
+			Body: &waProto.InteractiveMessage_Body{Text: proto.String(t.Body)},
+			InteractiveMessage: &waProto.InteractiveMessage_NativeFlowMessage_{
+				NativeFlowMessage: &waProto.InteractiveMessage_NativeFlowMessage{
+					Buttons:           buttons,
+					MessageParamsJSON: proto.String("{}"),
+					MessageVersion:    proto.Int32(1),
+				},
+			},
+		}
+		if t.Footer != "" {
+			interactive.Footer = &waProto.InteractiveMessage_Footer{Text: proto.String(t.Footer)}
+		}
+		if t.Header != nil {
+			interactive.Header, err = s.buildInteractiveHeader(r.Context(), cli, *t.Header)
+			if err != nil {
+				s.Respond(w, r, http.StatusBadRequest, err)
+				return
+			}
+		}
+
+		msgid := t.Id
+		if msgid == "" {
+			msgid = cli.GenerateMessageID()
+		}
+
+		// wrapped in a view once message, like SendButtons and SendList do
+		msg := &waProto.Message{ViewOnceMessage: &waProto.FutureProofMessage{
+			Message: &waProto.Message{
+				MessageContextInfo: &waProto.MessageContextInfo{
+					DeviceListMetadataVersion: proto.Int32(2),
+				},
+				InteractiveMessage: interactive,
+			},
+		}}
+		applyChatExpiration(msg, s.chatExpiration(cli, userid, recipient))
+
+		resp, err := cli.SendMessage(context.Background(), recipient, msg, whatsmeow.SendRequestExtra{ID: msgid})
+		if err != nil {
+			log.Error().Str("error", fmt.Sprintf("%v", err)).Msg("Failed to send interactive message")
+			msg := fmt.Sprintf("Failed to send interactive message: %v", err)
+			s.Respond(w, r, http.StatusInternalServerError, msg)
+			return
+		}
+		s.messages.SaveSent(userid, cli, recipient, resp, msg)
+
+		log.Info().Str("timestamp", fmt.Sprintf("%v", resp.Timestamp)).Str("id", msgid).Msg("Message sent")
+		response := map[string]interface{}{"Details": "Sent", "Timestamp": resp.Timestamp, "Id": msgid}
+		responseJson, err := json.Marshal(response)
+
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+		} else {
+			s.Respond(w, r, http.StatusOK, string(responseJson))
+		}
+
+		return
+	}
+}
@@ -0,0 +1,519 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go.mau.fi/whatsmeow"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+const newsletterMessagesMaxCount = 100
+
+// parseNewsletterJID parses the JID sent on newsletter payloads, with or
+// without the @newsletter suffix
+func parseNewsletterJID(newsletterJID string) (types.JID, error) {
+	if newsletterJID == "" {
+		return types.JID{}, errors.New("Missing JID in Payload")
+	}
+	if !strings.ContainsRune(newsletterJID, '@') {
+		newsletterJID += "@" + types.NewsletterServer
+	}
+	jid, err := types.ParseJID(newsletterJID)
+	if err != nil || jid.Server != types.NewsletterServer {
+		return types.JID{}, errors.New("Could not parse Newsletter JID")
+	}
+	return jid, nil
+}
+
+// newsletterEventType returns the webhook type of a newsletter notification
+func newsletterEventType(evt interface{}) string {
+	switch evt.(type) {
+	case *events.NewsletterJoin:
+		return "Newsletter.Joined"
+	case *events.NewsletterLeave:
+		return "Newsletter.Left"
+	case *events.NewsletterMuteChange:
+		return "Newsletter.MuteChanged"
+	case *events.NewsletterLiveUpdate:
+		// view and reaction counts, the updates themselves are not included
+		return "Newsletter.LiveUpdate"
+	}
+	return "Newsletter.Updated"
+}
+
+// Creates a newsletter (channel)
+func (s *server) CreateNewsletter() http.HandlerFunc {
+
+	type createNewsletterStruct struct {
+		Name        string
+		Description string
+		Picture     string
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+		userid, _ := strconv.Atoi(txtid)
+
+		if clientPointer[userid] == nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New("No session"))
+			return
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		var t createNewsletterStruct
+		err := decoder.Decode(&t)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Could not decode Payload"))
+			return
+		}
+
+		if t.Name == "" {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Missing Name in Payload"))
+			return
+		}
+
+		params := whatsmeow.CreateNewsletterParams{Name: t.Name, Description: t.Description}
+		if t.Picture != "" {
+			data, err := decodeBase64(t.Picture)
+			if err != nil {
+				s.Respond(w, r, http.StatusBadRequest, err)
+				return
+			}
+			params.Picture, err = gerarImagemQuadrada(data, profilePhotoSize)
+			if err != nil {
+				s.Respond(w, r, http.StatusBadRequest, fmt.Errorf("Could not decode image: %v", err))
+				return
+			}
+		}
+
+		newsletter, err := clientPointer[userid].CreateNewsletter(params)
+		if err != nil {
+			log.Error().Str("error", fmt.Sprintf("%v", err)).Msg("Failed to create newsletter")
+			msg := fmt.Sprintf("Failed to create newsletter: %v", err)
+			s.Respond(w, r, http.StatusInternalServerError, msg)
+			return
+		}
+
+		responseJson, err := json.Marshal(newsletter)
+
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+		} else {
+			s.Respond(w, r, http.StatusOK, string(responseJson))
+		}
+
+		return
+	}
+}
+
+// Gets newsletter information by JID (?jid=) or invite link (?invite=)
+func (s *server) GetNewsletterInfo() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+		userid, _ := strconv.Atoi(txtid)
+
+		if clientPointer[userid] == nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New("No session"))
+			return
+		}
+
+		var newsletter *types.NewsletterMetadata
+		var err error
+		if invite := r.URL.Query().Get("invite"); invite != "" {
+			newsletter, err = clientPointer[userid].GetNewsletterInfoWithInvite(invite)
+		} else {
+			jid, perr := parseNewsletterJID(r.URL.Query().Get("jid"))
+			if perr != nil {
+				s.Respond(w, r, http.StatusBadRequest, errors.New("Missing jid or invite parameter"))
+				return
+			}
+			newsletter, err = clientPointer[userid].GetNewsletterInfo(jid)
+		}
+		if err != nil {
+			log.Error().Str("error", fmt.Sprintf("%v", err)).Msg("Failed to get newsletter info")
+			msg := fmt.Sprintf("Failed to get newsletter info: %v", err)
+			s.Respond(w, r, http.StatusInternalServerError, msg)
+			return
+		}
+
+		responseJson, err := json.Marshal(newsletter)
+
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+		} else {
+			s.Respond(w, r, http.StatusOK, string(responseJson))
+		}
+
+		return
+	}
+}
+
+// Lists the newsletters we follow or own
+func (s *server) ListNewsletters() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+		userid, _ := strconv.Atoi(txtid)
+
+		if clientPointer[userid] == nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New("No session"))
+			return
+		}
+
+		newsletters, err := clientPointer[userid].GetSubscribedNewsletters()
+		if err != nil {
+			log.Error().Str("error", fmt.Sprintf("%v", err)).Msg("Failed to list newsletters")
+			msg := fmt.Sprintf("Failed to list newsletters: %v", err)
+			s.Respond(w, r, http.StatusInternalServerError, msg)
+			return
+		}
+		if newsletters == nil {
+			newsletters = []*types.NewsletterMetadata{}
+		}
+
+		response := map[string]interface{}{"Newsletters": newsletters}
+		responseJson, err := json.Marshal(response)
+
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+		} else {
+			s.Respond(w, r, http.StatusOK, string(responseJson))
+		}
+
+		return
+	}
+}
+
+// Follows or unfollows a newsletter, by JID or invite link
+func (s *server) UpdateNewsletterFollow(follow bool) http.HandlerFunc {
+
+	type followNewsletterStruct struct {
+		JID    string
+		Invite string
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+		userid, _ := strconv.Atoi(txtid)
+
+		if clientPointer[userid] == nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New("No session"))
+			return
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		var t followNewsletterStruct
+		err := decoder.Decode(&t)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Could not decode Payload"))
+			return
+		}
+
+		var jid types.JID
+		if t.Invite != "" {
+			newsletter, err := clientPointer[userid].GetNewsletterInfoWithInvite(t.Invite)
+			if err != nil {
+				s.Respond(w, r, http.StatusBadRequest, fmt.Errorf("Failed to get newsletter info: %v", err))
+				return
+			}
+			jid = newsletter.ID
+		} else {
+			jid, err = parseNewsletterJID(t.JID)
+			if err != nil {
+				s.Respond(w, r, http.StatusBadRequest, err)
+				return
+			}
+		}
+
+		action := "follow"
+		if follow {
+			err = clientPointer[userid].FollowNewsletter(jid)
+		} else {
+			action = "unfollow"
+			err = clientPointer[userid].UnfollowNewsletter(jid)
+		}
+		if err != nil {
+			log.Error().Str("error", fmt.Sprintf("%v", err)).Str("action", action).Msg("Failed to update newsletter follow")
+			msg := fmt.Sprintf("Failed to %s newsletter: %v", action, err)
+			s.Respond(w, r, http.StatusInternalServerError, msg)
+			return
+		}
+
+		response := map[string]interface{}{"Details": fmt.Sprintf("Newsletter %sed successfully", action), "JID": jid.String()}
+		responseJson, err := json.Marshal(response)
+
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+		} else {
+			s.Respond(w, r, http.StatusOK, string(responseJson))
+		}
+
+		return
+	}
+}
+
+// Posts a text, image or video update to a newsletter we administer.
+// Newsletter media is uploaded unencrypted.
+func (s *server) SendNewsletterMessage(kind string) http.HandlerFunc {
+
+	type newsletterMessageStruct struct {
+		JID     string
+		Id      string
+		Text    string
+		Caption string
+		Image   string
+		Video   string
+		URL     string
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+		userid, _ := strconv.Atoi(txtid)
+
+		cli := clientPointer[userid]
+		if cli == nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New("No session"))
+			return
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		var t newsletterMessageStruct
+		err := decoder.Decode(&t)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Could not decode Payload"))
+			return
+		}
+
+		jid, err := parseNewsletterJID(t.JID)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		var msg *waProto.Message
+		extra := whatsmeow.SendRequestExtra{ID: t.Id}
+		switch kind {
+		case "text":
+			if t.Text == "" {
+				s.Respond(w, r, http.StatusBadRequest, errors.New("Missing Text in Payload"))
+				return
+			}
+			msg = &waProto.Message{
+				ExtendedTextMessage: &waProto.ExtendedTextMessage{
+					Text: proto.String(t.Text),
+				},
+			}
+
+		case "image":
+			filedata, err := statusMediaData(t.Image, t.URL)
+			if err != nil {
+				s.Respond(w, r, http.StatusBadRequest, err)
+				return
+			}
+			uploaded, err := cli.UploadNewsletter(context.Background(), filedata, whatsmeow.MediaImage)
+			if err != nil {
+				s.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("Failed to upload file: %v", err))
+				return
+			}
+			extra.MediaHandle = uploaded.Handle
+			thumb, _ := gerarThumbnailImagem(filedata)
+			msg = &waProto.Message{
+				ImageMessage: &waProto.ImageMessage{
+					Caption:       proto.String(t.Caption),
+					URL:           proto.String(uploaded.URL),
+					DirectPath:    proto.String(uploaded.DirectPath),
+					Mimetype:      proto.String(http.DetectContentType(filedata)),
+					FileSHA256:    uploaded.FileSHA256,
+					FileLength:    proto.Uint64(uploaded.FileLength),
+					JPEGThumbnail: thumb,
+				},
+			}
+
+		case "video":
+			filedata, err := statusMediaData(t.Video, t.URL)
+			if err != nil {
+				s.Respond(w, r, http.StatusBadRequest, err)
+				return
+			}
+			video, err := s.transcoder.ToVideo(r.Context(), filedata)
+			if err != nil {
+				s.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("Failed to convert video: %v", err))
+				return
+			}
+			uploaded, err := cli.UploadNewsletter(context.Background(), video.Data, whatsmeow.MediaVideo)
+			if err != nil {
+				s.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("Failed to upload file: %v", err))
+				return
+			}
+			extra.MediaHandle = uploaded.Handle
+			msg = &waProto.Message{
+				VideoMessage: &waProto.VideoMessage{
+					Caption:    proto.String(t.Caption),
+					URL:        proto.String(uploaded.URL),
+					DirectPath: proto.String(uploaded.DirectPath),
+					Mimetype:   proto.String(video.MimeType),
+					FileSHA256: uploaded.FileSHA256,
+					FileLength: proto.Uint64(uploaded.FileLength),
+					Seconds:    proto.Uint32(audioSeconds(video.Duration)),
+					Width:      proto.Uint32(uint32(video.Width)),
+					Height:     proto.Uint32(uint32(video.Height)),
+				},
+			}
+		}
+
+		if extra.ID == "" {
+			extra.ID = cli.GenerateMessageID()
+		}
+
+		resp, err := cli.SendMessage(context.Background(), jid, msg, extra)
+		if err != nil {
+			log.Error().Str("error", fmt.Sprintf("%v", err)).Msg("Failed to send newsletter message")
+			msg := fmt.Sprintf("Failed to send newsletter message: %v", err)
+			s.Respond(w, r, http.StatusInternalServerError, msg)
+			return
+		}
+		s.messages.SaveSent(userid, cli, jid, resp, msg)
+
+		log.Info().Str("timestamp", fmt.Sprintf("%v", resp.Timestamp)).Str("id", extra.ID).Str("newsletter", jid.String()).Msg("Newsletter message sent")
+		response := map[string]interface{}{"Details": "Sent", "Timestamp": resp.Timestamp, "Id": extra.ID, "ServerId": resp.ServerID}
+		responseJson, err := json.Marshal(response)
+
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+		} else {
+			s.Respond(w, r, http.StatusOK, string(responseJson))
+		}
+
+		return
+	}
+}
+
+// Gets the message history of a newsletter, newest first. Use ?before=
+// with the smallest ServerID received to get older messages.
+func (s *server) GetNewsletterMessages() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+		userid, _ := strconv.Atoi(txtid)
+
+		if clientPointer[userid] == nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New("No session"))
+			return
+		}
+
+		query := r.URL.Query()
+		jid, err := parseNewsletterJID(query.Get("jid"))
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Missing jid parameter"))
+			return
+		}
+
+		params := &whatsmeow.GetNewsletterMessagesParams{Count: 50}
+		if v := query.Get("count"); v != "" {
+			params.Count, err = strconv.Atoi(v)
+			if err != nil || params.Count < 1 || params.Count > newsletterMessagesMaxCount {
+				s.Respond(w, r, http.StatusBadRequest, fmt.Errorf("Invalid count parameter, must be between 1 and %d", newsletterMessagesMaxCount))
+				return
+			}
+		}
+		if v := query.Get("before"); v != "" {
+			before, err := strconv.Atoi(v)
+			if err != nil || before < 1 {
+				s.Respond(w, r, http.StatusBadRequest, errors.New("Invalid before parameter"))
+				return
+			}
+			params.Before = types.MessageServerID(before)
+		}
+
+		messages, err := clientPointer[userid].GetNewsletterMessages(jid, params)
+		if err != nil {
+			log.Error().Str("error", fmt.Sprintf("%v", err)).Msg("Failed to get newsletter messages")
+			msg := fmt.Sprintf("Failed to get newsletter messages: %v", err)
+			s.Respond(w, r, http.StatusInternalServerError, msg)
+			return
+		}
+		if messages == nil {
+			messages = []*types.NewsletterMessage{}
+		}
+
+		response := map[string]interface{}{"Messages": messages}
+		responseJson, err := json.Marshal(response)
+
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+		} else {
+			s.Respond(w, r, http.StatusOK, string(responseJson))
+		}
+
+		return
+	}
+}
+
+// Subscribes to live reaction and view count updates of a newsletter. WhatsApp
+// sends them for a limited time, returned in Duration (seconds).
+func (s *server) SubscribeNewsletterLive() http.HandlerFunc {
+
+	type newsletterLiveStruct struct {
+		JID string
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+		userid, _ := strconv.Atoi(txtid)
+
+		if clientPointer[userid] == nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New("No session"))
+			return
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		var t newsletterLiveStruct
+		err := decoder.Decode(&t)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Could not decode Payload"))
+			return
+		}
+
+		jid, err := parseNewsletterJID(t.JID)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		duration, err := clientPointer[userid].NewsletterSubscribeLiveUpdates(r.Context(), jid)
+		if err != nil {
+			log.Error().Str("error", fmt.Sprintf("%v", err)).Msg("Failed to subscribe to newsletter updates")
+			msg := fmt.Sprintf("Failed to subscribe to newsletter updates: %v", err)
+			s.Respond(w, r, http.StatusInternalServerError, msg)
+			return
+		}
+
+		response := map[string]interface{}{"Details": "Subscribed to live updates", "Duration": int(duration.Seconds())}
+		responseJson, err := json.Marshal(response)
+
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+		} else {
+			s.Respond(w, r, http.StatusOK, string(responseJson))
+		}
+
+		return
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// Values accepted by each privacy setting
+var privacySettingValues = map[types.PrivacySettingType][]types.PrivacySetting{
+	types.PrivacySettingTypeGroupAdd:     {types.PrivacySettingAll, types.PrivacySettingContacts, types.PrivacySettingContactBlacklist, types.PrivacySettingNone},
+	types.PrivacySettingTypeLastSeen:     {types.PrivacySettingAll, types.PrivacySettingContacts, types.PrivacySettingContactBlacklist, types.PrivacySettingNone},
+	types.PrivacySettingTypeStatus:       {types.PrivacySettingAll, types.PrivacySettingContacts, types.PrivacySettingContactBlacklist, types.PrivacySettingNone},
+	types.PrivacySettingTypeProfile:      {types.PrivacySettingAll, types.PrivacySettingContacts, types.PrivacySettingContactBlacklist, types.PrivacySettingNone},
+	types.PrivacySettingTypeReadReceipts: {types.PrivacySettingAll, types.PrivacySettingNone},
+	types.PrivacySettingTypeOnline:       {types.PrivacySettingAll, types.PrivacySettingMatchLastSeen},
+	types.PrivacySettingTypeCallAdd:      {types.PrivacySettingAll, types.PrivacySettingKnown},
+}
+
+// Setting names used in the API, as they are named in types.PrivacySettings
+var privacySettingNames = map[string]types.PrivacySettingType{
+	"GroupAdd":     types.PrivacySettingTypeGroupAdd,
+	"LastSeen":     types.PrivacySettingTypeLastSeen,
+	"Status":       types.PrivacySettingTypeStatus,
+	"Profile":      types.PrivacySettingTypeProfile,
+	"ReadReceipts": types.PrivacySettingTypeReadReceipts,
+	"Online":       types.PrivacySettingTypeOnline,
+	"CallAdd":      types.PrivacySettingTypeCallAdd,
+}
+
+// changedPrivacySettings lists the settings changed in a PrivacySettings
+// event. They are setting names, not event types, so they are not sent as
+// the changes of the webhook.
+func changedPrivacySettings(evt *events.PrivacySettings) []string {
+	var changes []string
+	for name, changed := range map[string]bool{
+		"GroupAdd":     evt.GroupAddChanged,
+		"LastSeen":     evt.LastSeenChanged,
+		"Status":       evt.StatusChanged,
+		"Profile":      evt.ProfileChanged,
+		"ReadReceipts": evt.ReadReceiptsChanged,
+		"Online":       evt.OnlineChanged,
+		"CallAdd":      evt.CallAddChanged,
+	} {
+		if changed {
+			changes = append(changes, name)
+		}
+	}
+	sort.Strings(changes)
+	return changes
+}
+
+// Gets privacy settings
+func (s *server) GetPrivacySettings() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+		userid, _ := strconv.Atoi(txtid)
+
+		if clientPointer[userid] == nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New("No session"))
+			return
+		}
+
+		settings, err := clientPointer[userid].TryFetchPrivacySettings(r.URL.Query().Get("refresh") == "true")
+		if err != nil {
+			log.Error().Str("error", fmt.Sprintf("%v", err)).Msg("Failed to get privacy settings")
+			msg := fmt.Sprintf("Failed to get privacy settings: %v", err)
+			s.Respond(w, r, http.StatusInternalServerError, msg)
+			return
+		}
+
+		responseJson, err := json.Marshal(settings)
+
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+		} else {
+			s.Respond(w, r, http.StatusOK, string(responseJson))
+		}
+
+		return
+	}
+}
+
+// Changes one or more privacy settings, sent as {"LastSeen":"contacts",...}
+func (s *server) SetPrivacySettings() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+		userid, _ := strconv.Atoi(txtid)
+
+		if clientPointer[userid] == nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New("No session"))
+			return
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		var t map[string]string
+		err := decoder.Decode(&t)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Could not decode Payload"))
+			return
+		}
+
+		if len(t) == 0 {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Missing privacy settings in Payload"))
+			return
+		}
+
+		// Validate everything before changing anything
+		for name, value := range t {
+			settingType, ok := privacySettingNames[name]
+			if !ok {
+				s.Respond(w, r, http.StatusBadRequest, fmt.Errorf("Invalid privacy setting: %s", name))
+				return
+			}
+			valid := false
+			for _, allowed := range privacySettingValues[settingType] {
+				valid = valid || string(allowed) == value
+			}
+			if !valid {
+				s.Respond(w, r, http.StatusBadRequest, fmt.Errorf("Invalid value %q for privacy setting %s, must be one of %v", value, name, privacySettingValues[settingType]))
+				return
+			}
+		}
+
+		var settings types.PrivacySettings
+		for name, value := range t {
+			settings, err = clientPointer[userid].SetPrivacySetting(privacySettingNames[name], types.PrivacySetting(value))
+			if err != nil {
+				log.Error().Str("error", fmt.Sprintf("%v", err)).Str("setting", name).Msg("Failed to set privacy setting")
+				msg := fmt.Sprintf("Failed to set privacy setting %s: %v", name, err)
+				s.Respond(w, r, http.StatusInternalServerError, msg)
+				return
+			}
+		}
+
+		responseJson, err := json.Marshal(settings)
+
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+		} else {
+			s.Respond(w, r, http.StatusOK, string(responseJson))
+		}
+
+		return
+	}
+}
+
+// Gets the list of blocked users
+func (s *server) GetBlocklist() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+		userid, _ := strconv.Atoi(txtid)
+
+		if clientPointer[userid] == nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New("No session"))
+			return
+		}
+
+		blocklist, err := clientPointer[userid].GetBlocklist()
+		if err != nil {
+			log.Error().Str("error", fmt.Sprintf("%v", err)).Msg("Failed to get blocklist")
+			msg := fmt.Sprintf("Failed to get blocklist: %v", err)
+			s.Respond(w, r, http.StatusInternalServerError, msg)
+			return
+		}
+
+		responseJson, err := json.Marshal(blocklistResponse(blocklist))
+
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+		} else {
+			s.Respond(w, r, http.StatusOK, string(responseJson))
+		}
+
+		return
+	}
+}
+
+func blocklistResponse(blocklist *types.Blocklist) map[string]interface{} {
+	jids := make([]string, len(blocklist.JIDs))
+	for i, jid := range blocklist.JIDs {
+		jids[i] = jid.String()
+	}
+	return map[string]interface{}{"DHash": blocklist.DHash, "JIDs": jids}
+}
+
+// Blocks or unblocks a user
+func (s *server) UpdateBlocklist(action events.BlocklistChangeAction) http.HandlerFunc {
+
+	type blockStruct struct {
+		Phone string
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+		userid, _ := strconv.Atoi(txtid)
+
+		if clientPointer[userid] == nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New("No session"))
+			return
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		var t blockStruct
+		err := decoder.Decode(&t)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Could not decode Payload"))
+			return
+		}
+
+		if t.Phone == "" {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Missing Phone in Payload"))
+			return
+		}
+
+		// Numbers that are no longer on WhatsApp can still be unblocked
+		resolved, err := s.resolver.Resolve(clientPointer[userid], t.Phone)
+		if err != nil && !(errors.Is(err, ErrNotOnWhatsApp) && action == events.BlocklistChangeActionUnblock) {
+			s.Respond(w, r, http.StatusBadRequest, err)
+			return
+		}
+		jid := resolved.JID
+		if jid.Server != types.DefaultUserServer && jid.Server != types.HiddenUserServer {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Only users can be blocked"))
+			return
+		}
+
+		blocklist, err := clientPointer[userid].UpdateBlocklist(jid, action)
+		if err != nil {
+			log.Error().Str("error", fmt.Sprintf("%v", err)).Str("action", string(action)).Msg("Failed to update blocklist")
+			msg := fmt.Sprintf("Failed to %s user: %v", action, err)
+			s.Respond(w, r, http.StatusInternalServerError, msg)
+			return
+		}
+
+		response := blocklistResponse(blocklist)
+		response["Details"] = fmt.Sprintf("User %sed successfully", action)
+		response["JID"] = jid.String()
+		responseJson, err := json.Marshal(response)
+
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+		} else {
+			s.Respond(w, r, http.StatusOK, string(responseJson))
+		}
+
+		return
+	}
+}
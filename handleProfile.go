@@ -0,0 +1,263 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/appstate"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Size of the profile picture sent to WhatsApp
+const profilePhotoSize = 640
+
+// Gets our own profile: JID, push name, about, picture and business profile
+func (s *server) GetProfile() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+		userid, _ := strconv.Atoi(txtid)
+
+		cli := clientPointer[userid]
+		if cli == nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New("No session"))
+			return
+		}
+
+		if cli.Store.ID == nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New("Not logged in"))
+			return
+		}
+		own := cli.Store.ID.ToNonAD()
+
+		response := map[string]interface{}{
+			"JID":          own.String(),
+			"PushName":     cli.Store.PushName,
+			"BusinessName": cli.Store.BusinessName,
+		}
+
+		info, err := cli.GetUserInfo([]types.JID{own})
+		if err != nil {
+			log.Warn().Err(err).Msg("Could not get own user info")
+		} else if user, ok := info[own]; ok {
+			response["About"] = user.Status
+			response["PictureID"] = user.PictureID
+			if user.VerifiedName != nil && user.VerifiedName.Details != nil {
+				response["VerifiedName"] = user.VerifiedName.Details.GetVerifiedName()
+			}
+		}
+
+		pic, err := cli.GetProfilePictureInfo(own, &whatsmeow.GetProfilePictureParams{})
+		if err != nil && !errors.Is(err, whatsmeow.ErrProfilePictureNotSet) {
+			log.Warn().Err(err).Msg("Could not get own profile picture")
+		} else if pic != nil {
+			response["PictureURL"] = pic.URL
+		}
+
+		if cli.Store.BusinessName != "" {
+			business, err := cli.GetBusinessProfile(own)
+			if err != nil {
+				log.Warn().Err(err).Msg("Could not get own business profile")
+			} else {
+				response["BusinessProfile"] = business
+			}
+		}
+
+		responseJson, err := json.Marshal(response)
+
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+		} else {
+			s.Respond(w, r, http.StatusOK, string(responseJson))
+		}
+
+		return
+	}
+}
+
+// Sets our push name
+func (s *server) SetProfileName() http.HandlerFunc {
+
+	type profileNameStruct struct {
+		Name string
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+		userid, _ := strconv.Atoi(txtid)
+
+		cli := clientPointer[userid]
+		if cli == nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New("No session"))
+			return
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		var t profileNameStruct
+		err := decoder.Decode(&t)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Could not decode Payload"))
+			return
+		}
+
+		t.Name = strings.TrimSpace(t.Name)
+		if t.Name == "" {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Missing Name in Payload"))
+			return
+		}
+
+		err = cli.SendAppState(appstate.BuildSettingPushName(t.Name))
+		if err != nil {
+			log.Error().Str("error", fmt.Sprintf("%v", err)).Msg("Failed to set push name")
+			msg := fmt.Sprintf("Failed to set push name: %v", err)
+			s.Respond(w, r, http.StatusInternalServerError, msg)
+			return
+		}
+		cli.Store.PushName = t.Name
+
+		// Contacts learn the new name from our presence
+		err = cli.SendPresence(types.PresenceAvailable)
+		if err != nil {
+			log.Warn().Err(err).Msg("Could not send presence after changing push name")
+		}
+
+		response := map[string]interface{}{"Details": "Push name set successfully"}
+		responseJson, err := json.Marshal(response)
+
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+		} else {
+			s.Respond(w, r, http.StatusOK, string(responseJson))
+		}
+
+		return
+	}
+}
+
+// Sets our about (status) text
+func (s *server) SetProfileAbout() http.HandlerFunc {
+
+	type profileAboutStruct struct {
+		About string
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+		userid, _ := strconv.Atoi(txtid)
+
+		if clientPointer[userid] == nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New("No session"))
+			return
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		var t profileAboutStruct
+		err := decoder.Decode(&t)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Could not decode Payload"))
+			return
+		}
+
+		err = clientPointer[userid].SetStatusMessage(t.About)
+		if err != nil {
+			log.Error().Str("error", fmt.Sprintf("%v", err)).Msg("Failed to set about")
+			msg := fmt.Sprintf("Failed to set about: %v", err)
+			s.Respond(w, r, http.StatusInternalServerError, msg)
+			return
+		}
+
+		response := map[string]interface{}{"Details": "About set successfully"}
+		responseJson, err := json.Marshal(response)
+
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+		} else {
+			s.Respond(w, r, http.StatusOK, string(responseJson))
+		}
+
+		return
+	}
+}
+
+// Sets or removes our profile picture. The image is cropped to a square and
+// resized to a JPEG before being sent.
+func (s *server) SetProfilePhoto() http.HandlerFunc {
+
+	type profilePhotoStruct struct {
+		Image  string
+		URL    string
+		Remove bool
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+		userid, _ := strconv.Atoi(txtid)
+
+		if clientPointer[userid] == nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New("No session"))
+			return
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		var t profilePhotoStruct
+		err := decoder.Decode(&t)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Could not decode Payload"))
+			return
+		}
+
+		var photo []byte
+		if !t.Remove {
+			var data []byte
+			switch {
+			case t.Image != "":
+				data, err = decodeBase64(t.Image)
+			case t.URL != "":
+				data, err = fetchMediaFromUrl(t.URL)
+			default:
+				err = errors.New("Missing Image or URL in Payload")
+			}
+			if err != nil {
+				s.Respond(w, r, http.StatusBadRequest, err)
+				return
+			}
+			photo, err = gerarImagemQuadrada(data, profilePhotoSize)
+			if err != nil {
+				s.Respond(w, r, http.StatusBadRequest, fmt.Errorf("Could not decode image: %v", err))
+				return
+			}
+		}
+
+		// Without a target the picture is set on our own profile
+		pictureID, err := clientPointer[userid].SetGroupPhoto(types.EmptyJID, photo)
+		if err != nil {
+			log.Error().Str("error", fmt.Sprintf("%v", err)).Msg("Failed to set profile photo")
+			msg := fmt.Sprintf("Failed to set profile photo: %v", err)
+			s.Respond(w, r, http.StatusInternalServerError, msg)
+			return
+		}
+
+		response := map[string]interface{}{"Details": "Profile photo set successfully", "PictureID": pictureID}
+		if t.Remove {
+			response["Details"] = "Profile photo removed successfully"
+		}
+		responseJson, err := json.Marshal(response)
+
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+		} else {
+			s.Respond(w, r, http.StatusOK, string(responseJson))
+		}
+
+		return
+	}
+}
@@ -7,12 +7,10 @@ import (
 	"errors"
 	"fmt"
 	"image"
+	"image/draw"
 	"image/jpeg"
-	"io"
-	"math"
+	_ "image/png"
 	"net/http"
-	"os"
-	"os/exec"
 	"strconv"
 	"strings"
 
@@ -33,6 +31,12 @@ func (s *server) SendMedia() http.HandlerFunc {
 		Caption       string              `json:"caption,omitempty"`       // imagem, vídeo ou documento
 		JPEGThumbnail []byte              `json:"jpegThumbnail,omitempty"` // imagem / vídeo / sticker
 		Id            string              `json:"id,omitempty"`
+		PTT           *bool               `json:"ptt,omitempty"`           // áudio: mensagem de voz (padrão) ou arquivo de áudio
+		PackName      string              `json:"packName,omitempty"`      // sticker: nome do pacote
+		PackPublisher string              `json:"packPublisher,omitempty"` // sticker: autor do pacote
+		Emojis        []string            `json:"emojis,omitempty"`        // sticker: emojis associados
+		MentionAll    bool                `json:"mentionAll,omitempty"`    // grupos: menciona todos os participantes
+		ViewOnce      bool                `json:"viewOnce,omitempty"`      // imagem, vídeo ou áudio: visualização única
 		ContextInfo   waProto.ContextInfo `json:"contextInfo"`
 	}
 
@@ -48,13 +52,14 @@ func (s *server) SendMedia() http.HandlerFunc {
 			return
 		}
 
-		// Faz o parse do JSON de entrada
-		decoder := json.NewDecoder(r.Body)
+		// Faz o parse da entrada (JSON ou multipart/form-data com o arquivo)
 		var req mediaRequest
-		if err := decoder.Decode(&req); err != nil {
-			s.Respond(w, r, http.StatusBadRequest, errors.New("Falha ao decodificar JSON de entrada"))
+		upload, err := decodeMediaPayload(r, &req)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, fmt.Errorf("Falha ao decodificar a requisição: %v", err))
 			return
 		}
+		defer upload.Remove()
 
 		// Valida entradas obrigatórias
 		if req.Phone == "" {
@@ -66,14 +71,26 @@ func (s *server) SendMedia() http.HandlerFunc {
 			return
 		}
 
+		if t := strings.ToLower(req.MediaType); req.ViewOnce && t != "image" && t != "video" && t != "audio" {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Campo 'viewOnce' só pode ser usado com image, video ou audio"))
+			return
+		}
+
 		// Monta e valida o destinatário
-		recipient, err := validateMessageFields(req.Phone, req.ContextInfo.StanzaID, req.ContextInfo.Participant)
+		recipient, err := s.validateMessageFields(clientPointer[userid], req.Phone, req.ContextInfo.StanzaID, req.ContextInfo.Participant)
 		if err != nil {
 			log.Error().Msg(fmt.Sprintf("%s", err))
 			s.Respond(w, r, http.StatusBadRequest, err)
 			return
 		}
 
+		// Resolve os placeholders "@{telefone}" da legenda e o mentionAll
+		req.Caption, req.ContextInfo.MentionedJID, err = resolveMentions(clientPointer[userid], recipient, req.Caption, req.MentionAll, req.ContextInfo.MentionedJID)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, err)
+			return
+		}
+
 		// ID da mensagem (se não vier, gera um)
 		msgid := req.Id
 		if msgid == "" {
@@ -85,9 +102,19 @@ func (s *server) SendMedia() http.HandlerFunc {
 		var uploaded whatsmeow.UploadResponse
 		var filedata []byte
 
-		// 1) Tenta decodificar do Base64, se foi fornecido
-		// 2) Caso contrário, se "mediaUrl" estiver presente, faz o download
-		if req.Base64 != "" {
+		// 1) Usa o arquivo enviado via multipart, se houver
+		// 2) Tenta decodificar do Base64, se foi fornecido
+		// 3) Caso contrário, se "mediaUrl" estiver presente, faz o download
+		if upload != nil {
+			filedata, err = upload.Bytes()
+			if err != nil {
+				s.Respond(w, r, http.StatusInternalServerError, err)
+				return
+			}
+			if req.FileName == "" {
+				req.FileName = upload.FileName
+			}
+		} else if req.Base64 != "" {
 			// Decodifica do base64
 			fdat, mimeErr := decodeBase64(req.Base64)
 			if mimeErr != nil {
@@ -113,41 +140,21 @@ func (s *server) SendMedia() http.HandlerFunc {
 			}
 		} else {
 			s.Respond(w, r, http.StatusBadRequest,
-				errors.New("Você deve informar 'base64' ou 'mediaUrl'"))
+				errors.New("Você deve informar 'base64', 'mediaUrl' ou enviar o arquivo via multipart"))
 			return
 		}
 
 		// Função auxiliar para setar ContextInfo (citação de mensagem anterior e menções)
 		setContextInfo := func(msg *waProto.Message) {
-			if req.ContextInfo.Expiration != nil {
-				msg.ExtendedTextMessage.ContextInfo = &waProto.ContextInfo{
-					Expiration: proto.Uint32(*req.ContextInfo.Expiration),
-				}
-			}
-
-			if req.ContextInfo.StanzaID != nil {
-				if msg.ExtendedTextMessage == nil {
-					msg.ExtendedTextMessage = &waProto.ExtendedTextMessage{}
-				}
-				msg.ExtendedTextMessage.ContextInfo = &waProto.ContextInfo{
-					StanzaID:      proto.String(*req.ContextInfo.StanzaID),
-					Participant:   proto.String(*req.ContextInfo.Participant),
-					QuotedMessage: &waProto.Message{Conversation: proto.String("")},
-				}
-			}
-			if req.ContextInfo.MentionedJID != nil {
-				if msg.ExtendedTextMessage == nil {
-					msg.ExtendedTextMessage = &waProto.ExtendedTextMessage{}
-				}
-				if msg.ExtendedTextMessage.ContextInfo == nil {
-					msg.ExtendedTextMessage.ContextInfo = &waProto.ContextInfo{}
-				}
-				msg.ExtendedTextMessage.ContextInfo.MentionedJID = req.ContextInfo.MentionedJID
-			}
+			s.applyContextInfo(userid, recipient, msg, &req.ContextInfo)
 		}
 
-		// Função de envio da mensagem
+		// Função de envio da mensagem (com visualização única, se pedida)
 		sendMessage := func(msg *waProto.Message, logMsg string, erroMsg string) {
+			if req.ViewOnce {
+				msg = viewOnceMessage(msg)
+			}
+
 			resp, erro := clientPointer[userid].SendMessage(
 				context.Background(), recipient, msg, whatsmeow.SendRequestExtra{ID: msgid},
 			)
@@ -155,7 +162,8 @@ func (s *server) SendMedia() http.HandlerFunc {
 				s.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("%s: %v", erroMsg, erro))
 				return
 			}
-			log.Info().Str("timestamp", fmt.Sprintf("%d", resp.Timestamp)).
+			s.messages.SaveSent(userid, clientPointer[userid], recipient, resp, msg)
+			log.Info().Str("timestamp", fmt.Sprintf("%v", resp.Timestamp)).
 				Str("id", msgid).
 				Msg(logMsg)
 
@@ -175,36 +183,35 @@ func (s *server) SendMedia() http.HandlerFunc {
 
 		case "audio":
 
-			// Converte o arquivo WebM para OGG, se necessário
-			var duration uint32
-			if strings.HasSuffix(req.MediaUrl, ".webm") || strings.HasSuffix(req.MediaUrl, ".mp3") || strings.HasSuffix(req.MediaUrl, ".ogg") {
-
-				filedata, duration, err = convertWebMToOgg(filedata, req.FileName)
+			// Mensagem de voz por padrão; "ptt": false envia como arquivo de áudio
+			ptt := req.PTT == nil || *req.PTT
 
-				if err != nil {
-					s.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("Falha ao converter WebM para OGG: %v", err))
-					return
-				}
+			// Converte quando o codec detectado não for compatível e gera o waveform
+			audio, err := s.transcoder.ToAudio(r.Context(), filedata, ptt)
+			if err != nil {
+				s.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("Falha ao converter áudio: %v", err))
+				return
 			}
+			filedata = audio.Data
+
 			// Faz upload
 			uploaded, err = clientPointer[userid].Upload(context.Background(), filedata, whatsmeow.MediaAudio)
 			if err != nil {
 				s.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("Falha ao fazer upload do áudio: %v", err))
 				return
 			}
-			ptt := true
-			mime := "audio/ogg; codecs=opus"
 			msg := &waProto.Message{
 				AudioMessage: &waProto.AudioMessage{
 					URL:           proto.String(uploaded.URL),
 					DirectPath:    proto.String(uploaded.DirectPath),
 					MediaKey:      uploaded.MediaKey,
-					Mimetype:      proto.String(mime),
+					Mimetype:      proto.String(audio.MimeType),
 					FileEncSHA256: uploaded.FileEncSHA256,
 					FileSHA256:    uploaded.FileSHA256,
 					FileLength:    proto.Uint64(uint64(len(filedata))),
-					PTT:           &ptt,
-					Seconds:       proto.Uint32(uint32(duration)),
+					PTT:           proto.Bool(ptt),
+					Seconds:       proto.Uint32(audioSeconds(audio.Duration)),
+					Waveform:      audio.Waveform,
 				},
 			}
 			setContextInfo(msg)
@@ -213,26 +220,33 @@ func (s *server) SendMedia() http.HandlerFunc {
 			return
 
 		case "video":
-			var duration uint32
-			filedata, duration, err = convertWebMToOgg(filedata, req.FileName)
+			// Converte para mp4 H.264/AAC quando necessário
+			video, err := s.transcoder.ToVideo(r.Context(), filedata)
+			if err != nil {
+				s.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("Falha ao converter vídeo: %v", err))
+				return
+			}
+			filedata = video.Data
+
 			uploaded, err = clientPointer[userid].Upload(context.Background(), filedata, whatsmeow.MediaVideo)
 			if err != nil {
 				s.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("Falha ao fazer upload do vídeo: %v", err))
 				return
 			}
-			mimetype := http.DetectContentType(filedata)
 			msg := &waProto.Message{
 				VideoMessage: &waProto.VideoMessage{
 					Caption:       proto.String(req.Caption),
 					URL:           proto.String(uploaded.URL),
 					DirectPath:    proto.String(uploaded.DirectPath),
 					MediaKey:      uploaded.MediaKey,
-					Mimetype:      proto.String(mimetype),
+					Mimetype:      proto.String(video.MimeType),
 					FileEncSHA256: uploaded.FileEncSHA256,
 					FileSHA256:    uploaded.FileSHA256,
 					FileLength:    proto.Uint64(uint64(len(filedata))),
 					JPEGThumbnail: req.JPEGThumbnail,
-					Seconds:       proto.Uint32(uint32(duration)),
+					Seconds:       proto.Uint32(audioSeconds(video.Duration)),
+					Width:         proto.Uint32(uint32(video.Width)),
+					Height:        proto.Uint32(uint32(video.Height)),
 				},
 			}
 			setContextInfo(msg)
@@ -266,31 +280,30 @@ func (s *server) SendMedia() http.HandlerFunc {
 					JPEGThumbnail: thumb,
 				},
 			}
-			if req.ContextInfo.StanzaID != nil {
-				if msg.ImageMessage.ContextInfo == nil {
-					msg.ImageMessage.ContextInfo = &waProto.ContextInfo{}
-				}
-				msg.ImageMessage.ContextInfo.StanzaID = proto.String(*req.ContextInfo.StanzaID)
-				msg.ImageMessage.ContextInfo.Participant = proto.String(*req.ContextInfo.Participant)
-				msg.ImageMessage.ContextInfo.QuotedMessage = &waProto.Message{Conversation: proto.String("")}
-			}
-			if req.ContextInfo.MentionedJID != nil {
-				if msg.ImageMessage.ContextInfo == nil {
-					msg.ImageMessage.ContextInfo = &waProto.ContextInfo{}
-				}
-				msg.ImageMessage.ContextInfo.MentionedJID = req.ContextInfo.MentionedJID
-			}
+			setContextInfo(msg)
 
 			sendMessage(msg, "Imagem enviada", "Erro ao enviar imagem")
 			return
 
 		case "sticker":
+			// Converte para webp 512x512 (animado para GIFs e vídeos) com os dados do pacote
+			sticker, err := s.transcoder.ToSticker(r.Context(), filedata, &StickerMetadata{
+				PackName:  req.PackName,
+				Publisher: req.PackPublisher,
+				Emojis:    req.Emojis,
+			})
+			if err != nil {
+				s.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("Falha ao converter sticker: %v", err))
+				return
+			}
+			filedata = sticker.Data
+
 			uploaded, err = clientPointer[userid].Upload(context.Background(), filedata, whatsmeow.MediaImage)
 			if err != nil {
 				s.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("Falha ao fazer upload do sticker: %v", err))
 				return
 			}
-			mime := http.DetectContentType(filedata)
+			mime := sticker.MimeType
 
 			msg := &waProto.Message{
 				StickerMessage: &waProto.StickerMessage{
@@ -301,6 +314,9 @@ func (s *server) SendMedia() http.HandlerFunc {
 					FileEncSHA256: uploaded.FileEncSHA256,
 					FileSHA256:    uploaded.FileSHA256,
 					FileLength:    proto.Uint64(uint64(len(filedata))),
+					Width:         proto.Uint32(uint32(sticker.Width)),
+					Height:        proto.Uint32(uint32(sticker.Height)),
+					IsAnimated:    proto.Bool(sticker.Animated),
 					PngThumbnail:  req.JPEGThumbnail,
 				},
 			}
@@ -368,27 +384,43 @@ func gerarThumbnailImagem(origem []byte) ([]byte, error) {
 	}
 	// Redimensiona para 72x72 usando Lanczos3
 	m := resize.Thumbnail(72, 72, img, resize.Lanczos3)
+	return codificarJPEG(m)
+}
 
-	tmpFile, err := os.CreateTemp("", "thumbnail-*.jpg")
+// gerarImagemQuadrada - recorta o centro da imagem em um quadrado e redimensiona
+// para tamanho x tamanho, no formato JPEG usado em fotos de perfil e de grupo.
+func gerarImagemQuadrada(origem []byte, tamanho uint) ([]byte, error) {
+	reader := bytes.NewReader(origem)
+	img, _, err := image.Decode(reader)
 	if err != nil {
 		return nil, err
 	}
-	defer os.Remove(tmpFile.Name())
-	defer tmpFile.Close()
 
-	if err := jpeg.Encode(tmpFile, m, nil); err != nil {
-		return nil, err
+	bounds := img.Bounds()
+	lado := bounds.Dx()
+	if bounds.Dy() < lado {
+		lado = bounds.Dy()
 	}
-	if err := tmpFile.Sync(); err != nil {
-		return nil, err
+	x := bounds.Min.X + (bounds.Dx()-lado)/2
+	y := bounds.Min.Y + (bounds.Dy()-lado)/2
+	recorte := image.NewRGBA(image.Rect(0, 0, lado, lado))
+	draw.Draw(recorte, recorte.Bounds(), img, image.Pt(x, y), draw.Src)
+
+	// Não amplia imagens menores que o tamanho pedido
+	if uint(lado) < tamanho {
+		tamanho = uint(lado)
 	}
+	m := resize.Resize(tamanho, tamanho, recorte, resize.Lanczos3)
+	return codificarJPEG(m)
+}
 
-	thumbBytes, err := os.ReadFile(tmpFile.Name())
-	if err != nil {
+// codificarJPEG - codifica a imagem em JPEG
+func codificarJPEG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
 		return nil, err
 	}
-
-	return thumbBytes, nil
+	return buf.Bytes(), nil
 }
 
 // decodeBase64 - helper para decodificar string base64 que inicia com "data:..."
@@ -404,125 +436,11 @@ func decodeBase64(encoded string) ([]byte, error) {
 }
 
 // fetchMediaFromUrl - busca o arquivo de uma URL, retornando os bytes.
+// Usa o fetcher protegido (fetcher.go), que bloqueia destinos internos.
 func fetchMediaFromUrl(mediaUrl string) ([]byte, error) {
-	resp, err := http.Get(mediaUrl)
+	body, _, err := fetchRemote(context.Background(), mediaUrl)
 	if err != nil {
-		return nil, fmt.Errorf("Falha ao fazer GET na URL: %v", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("Falha ao buscar URL, status code: %d", resp.StatusCode)
-	}
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("Falha ao ler o conteúdo da URL: %v", err)
+		return nil, fmt.Errorf("Falha ao buscar a URL: %v", err)
 	}
 	return body, nil
 }
-
-// convertWebMToOgg converte um arquivo WebM, MP3 ou OGG para o formato de áudio "audio/ogg; codecs=opus".
-func convertWebMToOgg(input []byte, fileName string) ([]byte, uint32, error) {
-	// Função auxiliar para imprimir detalhes do áudio usando ffprobe
-	printAudioDetails := func(filePath string) (uint32, error) {
-
-		cmd := exec.Command("ffprobe", "-v", "error", "-select_streams", "a:0", "-show_entries", "format=duration", "-of", "default=noprint_wrappers=1:nokey=1", filePath)
-		output, err := cmd.CombinedOutput()
-		if err != nil {
-			fmt.Printf("Erro ao obter detalhes do áudio com ffprobe: %v\n", err)
-			return 0, err
-		}
-
-		details := strings.Split(strings.TrimSpace(string(output)), "\n")
-		var duration uint32
-		if len(details) >= 1 {
-			fmt.Printf("Duration: %s\n", details[0])
-			durationFloat, err := strconv.ParseFloat(details[0], 64)
-			if err == nil {
-				duration = uint32(math.Round(durationFloat))
-			}
-		} else {
-			fmt.Println("Detalhes do áudio não foram encontrados ou estão incompletos.")
-		}
-
-		// Detecta o mimeType usando o comando file
-
-		mimeCmd := exec.Command("file", "--mime-type", "-b", filePath)
-		mimeOutput, err := mimeCmd.CombinedOutput()
-		if err != nil {
-			fmt.Printf("Erro ao obter MIME Type: %v\n", err)
-			return 0, err
-		}
-		fmt.Printf("MIME Type: %s\n", strings.TrimSpace(string(mimeOutput)))
-
-		return duration, nil
-	}
-
-	// Cria um arquivo temporário para o arquivo de entrada
-
-	inputFile, err := os.CreateTemp("", "input-*")
-	if err != nil {
-		fmt.Printf("Erro ao criar arquivo temporário de entrada: %v\n", err)
-		return nil, 0, err
-	}
-	defer os.Remove(inputFile.Name())
-
-	// Escreve os dados de entrada no arquivo temporário
-
-	if _, err := inputFile.Write(input); err != nil {
-		fmt.Printf("Erro ao escrever dados de entrada: %v\n", err)
-		return nil, 0, err
-	}
-	inputFile.Close()
-
-	// Imprime detalhes do áudio antes da conversão
-
-	duration, err := printAudioDetails(inputFile.Name())
-	if err != nil {
-		return nil, 0, err
-	}
-
-	// Verifica se o arquivo precisa de conversão
-	if strings.HasSuffix(fileName, ".webm") || strings.HasSuffix(fileName, ".mp3") {
-
-		// Cria um arquivo temporário para o arquivo OGG de saída
-		outputFile, err := os.CreateTemp("", "output-*.ogg")
-		if err != nil {
-			fmt.Printf("Erro ao criar arquivo temporário de saída: %v\n", err)
-			return nil, 0, err
-		}
-		defer os.Remove(outputFile.Name())
-		outputFile.Close()
-
-		cmd := exec.Command("ffmpeg", "-y", "-i", inputFile.Name(), "-c:a", "libopus", "-b:a", "16k", "-ac", "1", "-ar", "48000", "-avoid_negative_ts", "make_zero", outputFile.Name())
-
-		// Captura a saída de erro padrão do ffmpeg
-		var stderr bytes.Buffer
-		cmd.Stderr = &stderr
-
-		// Executa o comando ffmpeg para converter o arquivo
-		if err := cmd.Run(); err != nil {
-			fmt.Printf("Erro ao executar ffmpeg: %v\n", err)
-			fmt.Printf("Detalhes do erro do ffmpeg: %s\n", stderr.String())
-			return nil, 0, err
-		}
-
-		duration, err = printAudioDetails(outputFile.Name())
-		if err != nil {
-			return nil, 0, err
-		}
-
-		convertedData, err := os.ReadFile(outputFile.Name())
-		if err != nil {
-			fmt.Printf("Erro ao ler arquivo de saída convertido: %v\n", err)
-			return nil, 0, err
-		}
-
-		return convertedData, duration, nil
-	}
-
-	fmt.Println("Arquivo não requer conversão. Retornando dados originais.")
-	// Se não for necessário converter, retorna os dados originais
-	return input, duration, nil
-}
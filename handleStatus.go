@@ -0,0 +1,474 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	waBinary "go.mau.fi/whatsmeow/binary"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	statusDefaultBackground = 0xff000000 // black, as in the WhatsApp apps
+	statusDefaultTextColor  = 0xffffffff
+	statusRecentMaxLimit    = 500
+)
+
+// parseARGB parses "#RRGGBB" or "#AARRGGBB" into an ARGB color
+func parseARGB(color string, fallback uint32) (uint32, error) {
+	if color == "" {
+		return fallback, nil
+	}
+	hex := strings.TrimPrefix(color, "#")
+	if len(hex) != 6 && len(hex) != 8 {
+		return 0, fmt.Errorf("Invalid color %q, use #RRGGBB or #AARRGGBB", color)
+	}
+	value, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid color %q, use #RRGGBB or #AARRGGBB", color)
+	}
+	if len(hex) == 6 {
+		value |= 0xff000000
+	}
+	return uint32(value), nil
+}
+
+// statusMediaData reads the media of a status from a data URL or a remote URL
+func statusMediaData(encoded, url string) ([]byte, error) {
+	switch {
+	case encoded != "":
+		return decodeBase64(encoded)
+	case url != "":
+		return fetchMediaFromUrl(url)
+	}
+	return nil, errors.New("Missing media in Payload")
+}
+
+// The status privacy of an account is changed while a status with its own
+// recipients is sent, so those sends are serialized per user
+var statusRecipientsLocks sync.Map
+
+// setStatusPrivacy changes who statuses are sent to. whatsmeow reads this
+// setting on every status it sends and has no way to pass the recipients
+// of a single status, so it is the only way to choose them.
+func setStatusPrivacy(cli *whatsmeow.Client, privacy types.StatusPrivacy) error {
+	users := make([]waBinary.Node, 0, len(privacy.List))
+	for _, jid := range privacy.List {
+		users = append(users, waBinary.Node{Tag: "user", Attrs: waBinary.Attrs{"jid": jid}})
+	}
+	_, err := cli.DangerousInternals().SendIQ(whatsmeow.DangerousInfoQuery{
+		Namespace: "status",
+		Type:      "set",
+		To:        types.ServerJID,
+		Content: []waBinary.Node{{
+			Tag: "privacy",
+			Content: []waBinary.Node{{
+				Tag:     "list",
+				Attrs:   waBinary.Attrs{"type": string(privacy.Type)},
+				Content: users,
+			}},
+		}},
+	})
+	return err
+}
+
+// sendStatusTo sends a status only to the given recipients, switching the
+// status privacy to them during the send and restoring it afterwards
+func sendStatusTo(cli *whatsmeow.Client, userID int, recipients []types.JID, msg *waProto.Message, extra whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error) {
+	lock, _ := statusRecipientsLocks.LoadOrStore(userID, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	previous, err := cli.GetStatusPrivacy()
+	if err != nil {
+		return whatsmeow.SendResponse{}, fmt.Errorf("Could not get status privacy: %v", err)
+	}
+	if len(previous) == 0 {
+		previous = whatsmeow.DefaultStatusPrivacy
+	}
+	err = setStatusPrivacy(cli, types.StatusPrivacy{Type: types.StatusPrivacyTypeWhitelist, List: recipients})
+	if err != nil {
+		return whatsmeow.SendResponse{}, fmt.Errorf("Could not set status recipients: %v", err)
+	}
+	defer func() {
+		if err := setStatusPrivacy(cli, previous[0]); err != nil {
+			log.Error().Err(err).Int("user", userID).Msg("Failed to restore status privacy")
+		}
+	}()
+	return cli.SendMessage(context.Background(), types.StatusBroadcastJID, msg, extra)
+}
+
+// Posts a text, image or video status. Statuses are sent to the contacts
+// allowed by the status privacy setting of the account, or only to the
+// given Recipients.
+func (s *server) SendStatus(kind string) http.HandlerFunc {
+
+	type statusStruct struct {
+		Id              string
+		Text            string
+		BackgroundColor string
+		TextColor       string
+		Font            int32
+		Caption         string
+		Image           string
+		Video           string
+		URL             string
+		Recipients      []string
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+		userid, _ := strconv.Atoi(txtid)
+
+		cli := clientPointer[userid]
+		if cli == nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New("No session"))
+			return
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		var t statusStruct
+		err := decoder.Decode(&t)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Could not decode Payload"))
+			return
+		}
+
+		var recipients []types.JID
+		for _, phone := range t.Recipients {
+			jid, err := s.resolveRecipient(cli, phone)
+			if err != nil {
+				s.Respond(w, r, http.StatusBadRequest, fmt.Errorf("Could not resolve Recipient %s: %v", phone, err))
+				return
+			}
+			if jid.Server != types.DefaultUserServer {
+				s.Respond(w, r, http.StatusBadRequest, fmt.Errorf("Recipient %s is not a user", phone))
+				return
+			}
+			recipients = append(recipients, jid)
+		}
+
+		var msg *waProto.Message
+		switch kind {
+		case "text":
+			if strings.TrimSpace(t.Text) == "" {
+				s.Respond(w, r, http.StatusBadRequest, errors.New("Missing Text in Payload"))
+				return
+			}
+			background, err := parseARGB(t.BackgroundColor, statusDefaultBackground)
+			if err != nil {
+				s.Respond(w, r, http.StatusBadRequest, err)
+				return
+			}
+			textColor, err := parseARGB(t.TextColor, statusDefaultTextColor)
+			if err != nil {
+				s.Respond(w, r, http.StatusBadRequest, err)
+				return
+			}
+			if _, ok := waE2E.ExtendedTextMessage_FontType_name[t.Font]; !ok {
+				s.Respond(w, r, http.StatusBadRequest, fmt.Errorf("Invalid Font %d", t.Font))
+				return
+			}
+			msg = &waProto.Message{
+				ExtendedTextMessage: &waProto.ExtendedTextMessage{
+					Text:           proto.String(t.Text),
+					BackgroundArgb: proto.Uint32(background),
+					TextArgb:       proto.Uint32(textColor),
+					Font:           waProto.ExtendedTextMessage_FontType(t.Font).Enum(),
+				},
+			}
+
+		case "image":
+			filedata, err := statusMediaData(t.Image, t.URL)
+			if err != nil {
+				s.Respond(w, r, http.StatusBadRequest, err)
+				return
+			}
+			uploaded, err := cli.Upload(context.Background(), filedata, whatsmeow.MediaImage)
+			if err != nil {
+				s.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("Failed to upload file: %v", err))
+				return
+			}
+			thumb, _ := gerarThumbnailImagem(filedata)
+			msg = &waProto.Message{
+				ImageMessage: &waProto.ImageMessage{
+					Caption:       proto.String(t.Caption),
+					URL:           proto.String(uploaded.URL),
+					DirectPath:    proto.String(uploaded.DirectPath),
+					MediaKey:      uploaded.MediaKey,
+					Mimetype:      proto.String(http.DetectContentType(filedata)),
+					FileEncSHA256: uploaded.FileEncSHA256,
+					FileSHA256:    uploaded.FileSHA256,
+					FileLength:    proto.Uint64(uint64(len(filedata))),
+					JPEGThumbnail: thumb,
+				},
+			}
+
+		case "video":
+			filedata, err := statusMediaData(t.Video, t.URL)
+			if err != nil {
+				s.Respond(w, r, http.StatusBadRequest, err)
+				return
+			}
+			video, err := s.transcoder.ToVideo(r.Context(), filedata)
+			if err != nil {
+				s.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("Failed to convert video: %v", err))
+				return
+			}
+			uploaded, err := cli.Upload(context.Background(), video.Data, whatsmeow.MediaVideo)
+			if err != nil {
+				s.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("Failed to upload file: %v", err))
+				return
+			}
+			msg = &waProto.Message{
+				VideoMessage: &waProto.VideoMessage{
+					Caption:       proto.String(t.Caption),
+					URL:           proto.String(uploaded.URL),
+					DirectPath:    proto.String(uploaded.DirectPath),
+					MediaKey:      uploaded.MediaKey,
+					Mimetype:      proto.String(video.MimeType),
+					FileEncSHA256: uploaded.FileEncSHA256,
+					FileSHA256:    uploaded.FileSHA256,
+					FileLength:    proto.Uint64(uint64(len(video.Data))),
+					Seconds:       proto.Uint32(audioSeconds(video.Duration)),
+					Width:         proto.Uint32(uint32(video.Width)),
+					Height:        proto.Uint32(uint32(video.Height)),
+				},
+			}
+		}
+
+		msgid := t.Id
+		if msgid == "" {
+			msgid = cli.GenerateMessageID()
+		}
+
+		var resp whatsmeow.SendResponse
+		if len(recipients) > 0 {
+			resp, err = sendStatusTo(cli, userid, recipients, msg, whatsmeow.SendRequestExtra{ID: msgid})
+		} else {
+			resp, err = cli.SendMessage(context.Background(), types.StatusBroadcastJID, msg, whatsmeow.SendRequestExtra{ID: msgid})
+		}
+		if err != nil {
+			log.Error().Str("error", fmt.Sprintf("%v", err)).Msg("Failed to post status")
+			msg := fmt.Sprintf("Failed to post status: %v", err)
+			s.Respond(w, r, http.StatusInternalServerError, msg)
+			return
+		}
+		s.messages.SaveSent(userid, cli, types.StatusBroadcastJID, resp, msg)
+
+		log.Info().Str("timestamp", fmt.Sprintf("%v", resp.Timestamp)).Str("id", msgid).Str("type", kind).Msg("Status posted")
+		response := map[string]interface{}{"Details": "Sent", "Timestamp": resp.Timestamp, "Id": msgid}
+		responseJson, err := json.Marshal(response)
+
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+		} else {
+			s.Respond(w, r, http.StatusOK, string(responseJson))
+		}
+
+		return
+	}
+}
+
+// Gets who our statuses are sent to
+func (s *server) GetStatusPrivacy() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+		userid, _ := strconv.Atoi(txtid)
+
+		if clientPointer[userid] == nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New("No session"))
+			return
+		}
+
+		privacy, err := clientPointer[userid].GetStatusPrivacy()
+		if err != nil {
+			log.Error().Str("error", fmt.Sprintf("%v", err)).Msg("Failed to get status privacy")
+			msg := fmt.Sprintf("Failed to get status privacy: %v", err)
+			s.Respond(w, r, http.StatusInternalServerError, msg)
+			return
+		}
+
+		response := map[string]interface{}{"Options": privacy}
+		responseJson, err := json.Marshal(response)
+
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+		} else {
+			s.Respond(w, r, http.StatusOK, string(responseJson))
+		}
+
+		return
+	}
+}
+
+// Lists the statuses received recently, from the message store
+func (s *server) GetRecentStatuses() http.HandlerFunc {
+
+	type statusEntry struct {
+		StoredMessage
+		Message *waProto.Message
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+		userid, _ := strconv.Atoi(txtid)
+
+		query := r.URL.Query()
+		hours, limit := 24, 100
+		if v := query.Get("hours"); v != "" {
+			parsed, err := strconv.Atoi(v)
+			if err != nil || parsed < 1 {
+				s.Respond(w, r, http.StatusBadRequest, errors.New("Invalid hours parameter"))
+				return
+			}
+			hours = parsed
+		}
+		if v := query.Get("limit"); v != "" {
+			parsed, err := strconv.Atoi(v)
+			if err != nil || parsed < 1 || parsed > statusRecentMaxLimit {
+				s.Respond(w, r, http.StatusBadRequest, fmt.Errorf("Invalid limit parameter, must be between 1 and %d", statusRecentMaxLimit))
+				return
+			}
+			limit = parsed
+		}
+		// statuses may be stored under the phone number or the LID of the author
+		var senders []string
+		if phone := query.Get("phone"); phone != "" {
+			resolved, err := s.resolver.Cached(phone)
+			if err != nil {
+				s.Respond(w, r, http.StatusBadRequest, err)
+				return
+			}
+			senders = append(senders, resolved.JID.ToNonAD().String())
+			if resolved.LID.User != "" && resolved.LID != resolved.JID {
+				senders = append(senders, resolved.LID.ToNonAD().String())
+			}
+		}
+
+		stored, err := s.messages.Recent(userid, types.StatusBroadcastJID, senders, time.Now().Add(-time.Duration(hours)*time.Hour), limit)
+		if err != nil {
+			log.Error().Str("error", fmt.Sprintf("%v", err)).Msg("Failed to read message store")
+			s.Respond(w, r, http.StatusInternalServerError, errors.New("Failed to read message store"))
+			return
+		}
+
+		statuses := make([]statusEntry, 0, len(stored))
+		for _, sm := range stored {
+			// revokes and other protocol messages are not statuses
+			if sm.Type == "protocol" {
+				continue
+			}
+			entry := statusEntry{StoredMessage: sm}
+			entry.Message, err = sm.Decode()
+			if err != nil {
+				log.Warn().Err(err).Str("id", sm.ID).Msg("Could not decode stored message")
+			}
+			statuses = append(statuses, entry)
+		}
+
+		response := map[string]interface{}{"Statuses": statuses}
+		responseJson, err := json.Marshal(response)
+
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+		} else {
+			s.Respond(w, r, http.StatusOK, string(responseJson))
+		}
+
+		return
+	}
+}
+
+// Marks a status as viewed, sending the read receipt to its author
+func (s *server) ViewStatus() http.HandlerFunc {
+
+	type viewStatusStruct struct {
+		Id    []string
+		Phone string
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+		userid, _ := strconv.Atoi(txtid)
+
+		if clientPointer[userid] == nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New("No session"))
+			return
+		}
+
+		decoder := json.NewDecoder(r.Body)
+		var t viewStatusStruct
+		err := decoder.Decode(&t)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Could not decode Payload"))
+			return
+		}
+
+		if len(t.Id) < 1 {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Missing Id in Payload"))
+			return
+		}
+
+		// The author is taken from the message store unless it is sent
+		var sender types.JID
+		if t.Phone != "" {
+			sender, err = s.resolveRecipient(clientPointer[userid], t.Phone)
+			if err != nil {
+				s.Respond(w, r, http.StatusBadRequest, err)
+				return
+			}
+		} else {
+			stored, err := s.messages.Get(userid, types.StatusBroadcastJID, t.Id[0])
+			if errors.Is(err, sql.ErrNoRows) {
+				s.Respond(w, r, http.StatusNotFound, errors.New("Status not found, send the Phone of its author"))
+				return
+			} else if err != nil {
+				s.Respond(w, r, http.StatusInternalServerError, errors.New("Failed to read message store"))
+				return
+			}
+			sender, _ = types.ParseJID(stored.Sender)
+		}
+
+		err = clientPointer[userid].MarkRead(t.Id, time.Now(), types.StatusBroadcastJID, sender)
+		if err != nil {
+			log.Error().Str("error", fmt.Sprintf("%v", err)).Msg("Failed to mark status as viewed")
+			msg := fmt.Sprintf("Failed to mark status as viewed: %v", err)
+			s.Respond(w, r, http.StatusInternalServerError, msg)
+			return
+		}
+		for _, id := range t.Id {
+			if err := s.messages.MarkViewed(userid, types.StatusBroadcastJID, id); err != nil {
+				log.Warn().Err(err).Str("id", id).Msg("Could not write message store")
+			}
+		}
+
+		response := map[string]interface{}{"Details": "Status marked as viewed"}
+		responseJson, err := json.Marshal(response)
+
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+		} else {
+			s.Respond(w, r, http.StatusOK, string(responseJson))
+		}
+
+		return
+	}
+}
@@ -38,7 +38,7 @@ func (v Values) Get(key string) string {
 	return v.m[key]
 }
 
-var messageTypes = []string{"Message", "ReadReceipt", "Presence", "HistorySync", "ChatPresence", "Connection", "All"}
+var messageTypes = []string{"Message", "ReadReceipt", "Presence", "HistorySync", "ChatPresence", "Connection", "Group", "Contact", "Privacy", "Status", "Newsletter", "Call", "Interactive", "All"}
 
 func (s *server) authadmin(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -60,6 +60,7 @@ func (s *server) authalice(next http.Handler) http.Handler {
 		webhook := ""
 		jid := ""
 		events := ""
+		webhookFormat := ""
 
 		// Get token from headers or uri parameters
 		token := r.Header.Get("token")
@@ -71,25 +72,26 @@ func (s *server) authalice(next http.Handler) http.Handler {
 		if !found {
 			log.Info().Msg("Looking for user information in DB")
 			// Checks DB from matching user and store user values in context
-			rows, err := s.db.Query("SELECT id,webhook,jid,events FROM users WHERE token=$1 LIMIT 1", token)
+			rows, err := s.db.Query("SELECT id,webhook,jid,events,webhook_format FROM users WHERE token=$1 LIMIT 1", token)
 			if err != nil {
 				s.Respond(w, r, http.StatusInternalServerError, err)
 				return
 			}
 			defer rows.Close()
 			for rows.Next() {
-				err = rows.Scan(&txtid, &webhook, &jid, &events)
+				err = rows.Scan(&txtid, &webhook, &jid, &events, &webhookFormat)
 				if err != nil {
 					s.Respond(w, r, http.StatusInternalServerError, err)
 					return
 				}
 				userid, _ = strconv.Atoi(txtid)
 				v := Values{map[string]string{
-					"Id":      txtid,
-					"Jid":     jid,
-					"Webhook": webhook,
-					"Token":   token,
-					"Events":  events,
+					"Id":            txtid,
+					"Jid":           jid,
+					"Webhook":       webhook,
+					"Token":         token,
+					"Events":        events,
+					"WebhookFormat": webhookFormat,
 				}}
 
 				userinfocache.Set(token, v, cache.NoExpiration)
@@ -118,6 +120,7 @@ func (s *server) auth(handler http.HandlerFunc) http.HandlerFunc {
 		webhook := ""
 		jid := ""
 		events := ""
+		webhookFormat := ""
 
 		// Get token from headers or uri parameters
 		token := r.Header.Get("token")
@@ -129,25 +132,26 @@ func (s *server) auth(handler http.HandlerFunc) http.HandlerFunc {
 		if !found {
 			log.Info().Msg("Looking for user information in DB")
 			// Checks DB from matching user and store user values in context
-			rows, err := s.db.Query("SELECT id, webhook, jid, events FROM users WHERE token=$1 LIMIT 1", token)
+			rows, err := s.db.Query("SELECT id, webhook, jid, events, webhook_format FROM users WHERE token=$1 LIMIT 1", token)
 			if err != nil {
 				s.Respond(w, r, http.StatusInternalServerError, err)
 				return
 			}
 			defer rows.Close()
 			for rows.Next() {
-				err = rows.Scan(&txtid, &webhook, &jid, &events)
+				err = rows.Scan(&txtid, &webhook, &jid, &events, &webhookFormat)
 				if err != nil {
 					s.Respond(w, r, http.StatusInternalServerError, err)
 					return
 				}
 				userid, _ = strconv.Atoi(txtid)
 				v := Values{map[string]string{
-					"Id":      txtid,
-					"Jid":     jid,
-					"Webhook": webhook,
-					"Token":   token,
-					"Events":  events,
+					"Id":            txtid,
+					"Jid":           jid,
+					"Webhook":       webhook,
+					"Token":         token,
+					"Events":        events,
+					"WebhookFormat": webhookFormat,
 				}}
 
 				userinfocache.Set(token, v, cache.NoExpiration)
@@ -204,7 +208,7 @@ func (s *server) Connect() http.HandlerFunc {
 				}
 			} else {
 				for _, arg := range t.Subscribe {
-					if !Find(messageTypes, arg) {
+					if !isKnownEventType(arg) {
 						log.Warn().Str("Type", arg).Msg("Message type discarded")
 						continue
 					}
@@ -305,16 +309,17 @@ func (s *server) GetWebhook() http.HandlerFunc {
 
 		webhook := ""
 		events := ""
+		webhookFormat := ""
 		txtid := r.Context().Value("userinfo").(Values).Get("Id")
 
-		rows, err := s.db.Query("SELECT webhook,events FROM users WHERE id=$1 LIMIT 1", txtid)
+		rows, err := s.db.Query("SELECT webhook,events,webhook_format FROM users WHERE id=$1 LIMIT 1", txtid)
 		if err != nil {
 			s.Respond(w, r, http.StatusInternalServerError, errors.New(fmt.Sprintf("Could not get webhook: %v", err)))
 			return
 		}
 		defer rows.Close()
 		for rows.Next() {
-			err = rows.Scan(&webhook, &events)
+			err = rows.Scan(&webhook, &events, &webhookFormat)
 			if err != nil {
 				s.Respond(w, r, http.StatusInternalServerError, errors.New(fmt.Sprintf("Could not get webhook: %s", fmt.Sprintf("%s", err))))
 				return
@@ -328,7 +333,7 @@ func (s *server) GetWebhook() http.HandlerFunc {
 
 		eventarray := strings.Split(events, ",")
 
-		response := map[string]interface{}{"webhook": webhook, "subscribe": eventarray}
+		response := map[string]interface{}{"webhook": webhook, "subscribe": eventarray, "webhookFormat": webhookFormat}
 		responseJson, err := json.Marshal(response)
 		if err != nil {
 			s.Respond(w, r, http.StatusInternalServerError, err)
@@ -415,11 +420,12 @@ func (s *server) UpdateWebhook() http.HandlerFunc {
 	}
 }
 
-// SetWebhook sets the webhook URL and events for a user
+// SetWebhook sets the webhook URL, events and payload format for a user
 func (s *server) SetWebhook() http.HandlerFunc {
 	type webhookStruct struct {
-		WebhookURL string   `json:"webhook"`
-		Events     []string `json:"events"`
+		WebhookURL    string   `json:"webhook"`
+		Events        []string `json:"events"`
+		WebhookFormat string   `json:"webhookFormat"`
 	}
 	return func(w http.ResponseWriter, r *http.Request) {
 		txtid := r.Context().Value("userinfo").(Values).Get("Id")
@@ -437,7 +443,20 @@ func (s *server) SetWebhook() http.HandlerFunc {
 		webhook := t.WebhookURL
 		events := strings.Join(t.Events, ",")
 
-		_, err = s.db.Exec("UPDATE users SET webhook=$1, events=$2 WHERE id=$3", webhook, events, userid)
+		// keep the current format when none is given
+		webhookFormat := t.WebhookFormat
+		if webhookFormat == "" {
+			webhookFormat = r.Context().Value("userinfo").(Values).Get("WebhookFormat")
+		}
+		if webhookFormat == "" {
+			webhookFormat = webhookFormatRaw
+		}
+		if webhookFormat != webhookFormatRaw && webhookFormat != webhookFormatTyped {
+			s.Respond(w, r, http.StatusBadRequest, fmt.Errorf("Invalid webhookFormat %q, must be %s or %s", webhookFormat, webhookFormatRaw, webhookFormatTyped))
+			return
+		}
+
+		_, err = s.db.Exec("UPDATE users SET webhook=$1, events=$2, webhook_format=$3 WHERE id=$4", webhook, events, webhookFormat, userid)
 		if err != nil {
 			s.Respond(w, r, http.StatusInternalServerError, errors.New(fmt.Sprintf("Could not set webhook: %v", err)))
 			return
@@ -445,9 +464,10 @@ func (s *server) SetWebhook() http.HandlerFunc {
 
 		v := updateUserInfo(r.Context().Value("userinfo"), "Webhook", webhook)
 		v = updateUserInfo(v, "Events", events)
+		v = updateUserInfo(v, "WebhookFormat", webhookFormat)
 		userinfocache.Set(token, v, cache.NoExpiration)
 
-		response := map[string]interface{}{"webhook": webhook, "events": t.Events}
+		response := map[string]interface{}{"webhook": webhook, "events": t.Events, "webhookFormat": webhookFormat}
 		responseJson, err := json.Marshal(response)
 		if err != nil {
 			s.Respond(w, r, http.StatusInternalServerError, err)
@@ -661,30 +681,34 @@ func (s *server) SendDocument() http.HandlerFunc {
 			return
 		}
 
-		decoder := json.NewDecoder(r.Body)
 		var t documentStruct
-		err := decoder.Decode(&t)
+		upload, err := decodeMediaPayload(r, &t)
 		if err != nil {
-			s.Respond(w, r, http.StatusBadRequest, errors.New("Could not decode Payload"))
+			s.Respond(w, r, http.StatusBadRequest, err)
 			return
 		}
+		defer upload.Remove()
 
 		if t.Phone == "" {
 			s.Respond(w, r, http.StatusBadRequest, errors.New("Missing Phone in Payload"))
 			return
 		}
 
-		if t.Document == "" {
+		if t.Document == "" && upload == nil {
 			s.Respond(w, r, http.StatusBadRequest, errors.New("Missing Document in Payload"))
 			return
 		}
 
+		if t.FileName == "" && upload != nil {
+			t.FileName = upload.FileName
+		}
+
 		if t.FileName == "" {
 			s.Respond(w, r, http.StatusBadRequest, errors.New("Missing FileName in Payload"))
 			return
 		}
 
-		recipient, err := validateMessageFields(t.Phone, t.ContextInfo.StanzaID, t.ContextInfo.Participant)
+		recipient, err := s.validateMessageFields(clientPointer[userid], t.Phone, t.ContextInfo.StanzaID, t.ContextInfo.Participant)
 		if err != nil {
 			log.Error().Msg(fmt.Sprintf("%s", err))
 			s.Respond(w, r, http.StatusBadRequest, err)
@@ -700,24 +724,30 @@ func (s *server) SendDocument() http.HandlerFunc {
 		var uploaded whatsmeow.UploadResponse
 		var filedata []byte
 
-		if t.Document[0:29] == "data:application/octet-stream" {
+		if upload != nil {
+			filedata, err = upload.Bytes()
+			if err != nil {
+				s.Respond(w, r, http.StatusInternalServerError, err)
+				return
+			}
+		} else if strings.HasPrefix(t.Document, "data:application/octet-stream") {
 			dataURL, err := dataurl.DecodeString(t.Document)
 			if err != nil {
 				s.Respond(w, r, http.StatusBadRequest, errors.New("Could not decode base64 encoded data from payload"))
 				return
-			} else {
-				filedata = dataURL.Data
-				uploaded, err = clientPointer[userid].Upload(context.Background(), filedata, whatsmeow.MediaDocument)
-				if err != nil {
-					s.Respond(w, r, http.StatusInternalServerError, errors.New(fmt.Sprintf("Failed to upload file: %v", err)))
-					return
-				}
 			}
+			filedata = dataURL.Data
 		} else {
 			s.Respond(w, r, http.StatusBadRequest, errors.New("Document data should start with \"data:application/octet-stream;base64,\""))
 			return
 		}
 
+		uploaded, err = clientPointer[userid].Upload(context.Background(), filedata, whatsmeow.MediaDocument)
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New(fmt.Sprintf("Failed to upload file: %v", err)))
+			return
+		}
+
 		msg := &waProto.Message{DocumentMessage: &waProto.DocumentMessage{
 			URL:           proto.String(uploaded.URL),
 			FileName:      &t.FileName,
@@ -730,27 +760,16 @@ func (s *server) SendDocument() http.HandlerFunc {
 			Caption:       proto.String(t.Caption),
 		}}
 
-		if t.ContextInfo.StanzaID != nil {
-			msg.ExtendedTextMessage.ContextInfo = &waProto.ContextInfo{
-				StanzaID:      proto.String(*t.ContextInfo.StanzaID),
-				Participant:   proto.String(*t.ContextInfo.Participant),
-				QuotedMessage: &waProto.Message{Conversation: proto.String("")},
-			}
-		}
-		if t.ContextInfo.MentionedJID != nil {
-			if msg.ExtendedTextMessage.ContextInfo == nil {
-				msg.ExtendedTextMessage.ContextInfo = &waProto.ContextInfo{}
-			}
-			msg.ExtendedTextMessage.ContextInfo.MentionedJID = t.ContextInfo.MentionedJID
-		}
+		s.applyContextInfo(userid, recipient, msg, &t.ContextInfo)
 
 		resp, err = clientPointer[userid].SendMessage(context.Background(), recipient, msg, whatsmeow.SendRequestExtra{ID: msgid})
 		if err != nil {
 			s.Respond(w, r, http.StatusInternalServerError, errors.New(fmt.Sprintf("Error sending message: %v", err)))
 			return
 		}
+		s.messages.SaveSent(userid, clientPointer[userid], recipient, resp, msg)
 
-		log.Info().Str("timestamp", fmt.Sprintf("%d", resp.Timestamp)).Str("id", msgid).Msg("Message sent")
+		log.Info().Str("timestamp", fmt.Sprintf("%v", resp.Timestamp)).Str("id", msgid).Msg("Message sent")
 		response := map[string]interface{}{"Details": "Sent", "Timestamp": resp.Timestamp, "Id": msgid}
 		responseJson, err := json.Marshal(response)
 		if err != nil {
@@ -770,6 +789,8 @@ func (s *server) SendAudio() http.HandlerFunc {
 		Audio       string
 		Caption     string
 		Id          string
+		PTT         *bool
+		ViewOnce    bool
 		ContextInfo waProto.ContextInfo
 	}
 
@@ -785,25 +806,25 @@ func (s *server) SendAudio() http.HandlerFunc {
 			return
 		}
 
-		decoder := json.NewDecoder(r.Body)
 		var t audioStruct
-		err := decoder.Decode(&t)
+		upload, err := decodeMediaPayload(r, &t)
 		if err != nil {
-			s.Respond(w, r, http.StatusBadRequest, errors.New("Could not decode Payload"))
+			s.Respond(w, r, http.StatusBadRequest, err)
 			return
 		}
+		defer upload.Remove()
 
 		if t.Phone == "" {
 			s.Respond(w, r, http.StatusBadRequest, errors.New("Missing Phone in Payload"))
 			return
 		}
 
-		if t.Audio == "" {
+		if t.Audio == "" && upload == nil {
 			s.Respond(w, r, http.StatusBadRequest, errors.New("Missing Audio in Payload"))
 			return
 		}
 
-		recipient, err := validateMessageFields(t.Phone, t.ContextInfo.StanzaID, t.ContextInfo.Participant)
+		recipient, err := s.validateMessageFields(clientPointer[userid], t.Phone, t.ContextInfo.StanzaID, t.ContextInfo.Participant)
 		if err != nil {
 			log.Error().Msg(fmt.Sprintf("%s", err))
 			s.Respond(w, r, http.StatusBadRequest, err)
@@ -819,26 +840,40 @@ func (s *server) SendAudio() http.HandlerFunc {
 		var uploaded whatsmeow.UploadResponse
 		var filedata []byte
 
-		if t.Audio[0:14] == "data:audio/ogg" {
+		if upload != nil {
+			filedata, err = upload.Bytes()
+			if err != nil {
+				s.Respond(w, r, http.StatusInternalServerError, err)
+				return
+			}
+		} else if strings.HasPrefix(t.Audio, "data:audio/") || strings.HasPrefix(t.Audio, "data:application/octet-stream") {
+			// the format is detected from the content by the transcoder
 			dataURL, err := dataurl.DecodeString(t.Audio)
 			if err != nil {
 				s.Respond(w, r, http.StatusBadRequest, errors.New("Could not decode base64 encoded data from payload"))
 				return
-			} else {
-				filedata = dataURL.Data
-				uploaded, err = clientPointer[userid].Upload(context.Background(), filedata, whatsmeow.MediaAudio)
-				if err != nil {
-					s.Respond(w, r, http.StatusInternalServerError, errors.New(fmt.Sprintf("Failed to upload file: %v", err)))
-					return
-				}
 			}
+			filedata = dataURL.Data
 		} else {
-			s.Respond(w, r, http.StatusBadRequest, errors.New("Audio data should start with \"data:audio/ogg;base64,\""))
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Audio data should start with \"data:audio/<format>;base64,\" or \"data:application/octet-stream;base64,\""))
 			return
 		}
 
-		ptt := true
-		mime := "audio/ogg; codecs=opus"
+		ptt := t.PTT == nil || *t.PTT
+		audio, err := s.transcoder.ToAudio(r.Context(), filedata, ptt)
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New(fmt.Sprintf("Failed to convert audio: %v", err)))
+			return
+		}
+		filedata = audio.Data
+
+		uploaded, err = clientPointer[userid].Upload(context.Background(), filedata, whatsmeow.MediaAudio)
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New(fmt.Sprintf("Failed to upload file: %v", err)))
+			return
+		}
+
+		mime := audio.MimeType
 
 		msg := &waProto.Message{AudioMessage: &waProto.AudioMessage{
 			URL:        proto.String(uploaded.URL),
@@ -850,20 +885,13 @@ func (s *server) SendAudio() http.HandlerFunc {
 			FileSHA256:    uploaded.FileSHA256,
 			FileLength:    proto.Uint64(uint64(len(filedata))),
 			PTT:           &ptt,
+			Seconds:       proto.Uint32(audioSeconds(audio.Duration)),
+			Waveform:      audio.Waveform,
 		}}
 
-		if t.ContextInfo.StanzaID != nil {
-			msg.ExtendedTextMessage.ContextInfo = &waProto.ContextInfo{
-				StanzaID:      proto.String(*t.ContextInfo.StanzaID),
-				Participant:   proto.String(*t.ContextInfo.Participant),
-				QuotedMessage: &waProto.Message{Conversation: proto.String("")},
-			}
-		}
-		if t.ContextInfo.MentionedJID != nil {
-			if msg.ExtendedTextMessage.ContextInfo == nil {
-				msg.ExtendedTextMessage.ContextInfo = &waProto.ContextInfo{}
-			}
-			msg.ExtendedTextMessage.ContextInfo.MentionedJID = t.ContextInfo.MentionedJID
+		s.applyContextInfo(userid, recipient, msg, &t.ContextInfo)
+		if t.ViewOnce {
+			msg = viewOnceMessage(msg)
 		}
 
 		resp, err = clientPointer[userid].SendMessage(context.Background(), recipient, msg, whatsmeow.SendRequestExtra{ID: msgid})
@@ -871,8 +899,9 @@ func (s *server) SendAudio() http.HandlerFunc {
 			s.Respond(w, r, http.StatusInternalServerError, errors.New(fmt.Sprintf("Error sending message: %v", err)))
 			return
 		}
+		s.messages.SaveSent(userid, clientPointer[userid], recipient, resp, msg)
 
-		log.Info().Str("timestamp", fmt.Sprintf("%d", resp.Timestamp)).Str("id", msgid).Msg("Message sent")
+		log.Info().Str("timestamp", fmt.Sprintf("%v", resp.Timestamp)).Str("id", msgid).Msg("Message sent")
 		response := map[string]interface{}{"Details": "Sent", "Timestamp": resp.Timestamp, "Id": msgid}
 		responseJson, err := json.Marshal(response)
 		if err != nil {
@@ -892,6 +921,7 @@ func (s *server) SendImage() http.HandlerFunc {
 		Image       string
 		Caption     string
 		Id          string
+		ViewOnce    bool
 		ContextInfo waProto.ContextInfo
 	}
 
@@ -907,25 +937,25 @@ func (s *server) SendImage() http.HandlerFunc {
 			return
 		}
 
-		decoder := json.NewDecoder(r.Body)
 		var t imageStruct
-		err := decoder.Decode(&t)
+		upload, err := decodeMediaPayload(r, &t)
 		if err != nil {
-			s.Respond(w, r, http.StatusBadRequest, errors.New("Could not decode Payload"))
+			s.Respond(w, r, http.StatusBadRequest, err)
 			return
 		}
+		defer upload.Remove()
 
 		if t.Phone == "" {
 			s.Respond(w, r, http.StatusBadRequest, errors.New("Missing Phone in Payload"))
 			return
 		}
 
-		if t.Image == "" {
+		if t.Image == "" && upload == nil {
 			s.Respond(w, r, http.StatusBadRequest, errors.New("Missing Image in Payload"))
 			return
 		}
 
-		recipient, err := validateMessageFields(t.Phone, t.ContextInfo.StanzaID, t.ContextInfo.Participant)
+		recipient, err := s.validateMessageFields(clientPointer[userid], t.Phone, t.ContextInfo.StanzaID, t.ContextInfo.Participant)
 		if err != nil {
 			log.Error().Msg(fmt.Sprintf("%s", err))
 			s.Respond(w, r, http.StatusBadRequest, err)
@@ -942,52 +972,57 @@ func (s *server) SendImage() http.HandlerFunc {
 		var filedata []byte
 		var thumbnailBytes []byte
 
-		if t.Image[0:10] == "data:image" {
-			dataURL, err := dataurl.DecodeString(t.Image)
+		if upload != nil {
+			filedata, err = upload.Bytes()
 			if err != nil {
-				s.Respond(w, r, http.StatusBadRequest, errors.New("Could not decode base64 encoded data from payload"))
+				s.Respond(w, r, http.StatusInternalServerError, err)
 				return
-			} else {
-				filedata = dataURL.Data
-				uploaded, err = clientPointer[userid].Upload(context.Background(), filedata, whatsmeow.MediaImage)
-				if err != nil {
-					s.Respond(w, r, http.StatusInternalServerError, errors.New(fmt.Sprintf("Failed to upload file: %v", err)))
-					return
-				}
 			}
-
-			// decode jpeg into image.Image
-			reader := bytes.NewReader(filedata)
-			img, _, err := image.Decode(reader)
+		} else if strings.HasPrefix(t.Image, "data:image") {
+			dataURL, err := dataurl.DecodeString(t.Image)
 			if err != nil {
-				s.Respond(w, r, http.StatusInternalServerError, errors.New(fmt.Sprintf("Could not decode image for thumbnail preparation: %v", err)))
+				s.Respond(w, r, http.StatusBadRequest, errors.New("Could not decode base64 encoded data from payload"))
 				return
 			}
+			filedata = dataURL.Data
+		} else {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Image data should start with \"data:image/png;base64,\""))
+			return
+		}
 
-			// resize to width 72 using Lanczos resampling and preserve aspect ratio
-			m := resize.Thumbnail(72, 72, img, resize.Lanczos3)
+		uploaded, err = clientPointer[userid].Upload(context.Background(), filedata, whatsmeow.MediaImage)
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New(fmt.Sprintf("Failed to upload file: %v", err)))
+			return
+		}
 
-			tmpFile, err := os.CreateTemp("", "resized-*.jpg")
-			if err != nil {
-				s.Respond(w, r, http.StatusInternalServerError, errors.New(fmt.Sprintf("Could not create temp file for thumbnail: %v", err)))
-				return
-			}
-			defer tmpFile.Close()
+		// decode jpeg into image.Image
+		reader := bytes.NewReader(filedata)
+		img, _, err := image.Decode(reader)
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New(fmt.Sprintf("Could not decode image for thumbnail preparation: %v", err)))
+			return
+		}
 
-			// write new image to file
-			if err := jpeg.Encode(tmpFile, m, nil); err != nil {
-				s.Respond(w, r, http.StatusInternalServerError, errors.New(fmt.Sprintf("Failed to encode jpeg: %v", err)))
-				return
-			}
+		// resize to width 72 using Lanczos resampling and preserve aspect ratio
+		m := resize.Thumbnail(72, 72, img, resize.Lanczos3)
 
-			thumbnailBytes, err = os.ReadFile(tmpFile.Name())
-			if err != nil {
-				s.Respond(w, r, http.StatusInternalServerError, errors.New(fmt.Sprintf("Failed to read %s: %v", tmpFile.Name(), err)))
-				return
-			}
+		tmpFile, err := os.CreateTemp("", "resized-*.jpg")
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New(fmt.Sprintf("Could not create temp file for thumbnail: %v", err)))
+			return
+		}
+		defer tmpFile.Close()
 
-		} else {
-			s.Respond(w, r, http.StatusBadRequest, errors.New("Image data should start with \"data:image/png;base64,\""))
+		// write new image to file
+		if err := jpeg.Encode(tmpFile, m, nil); err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New(fmt.Sprintf("Failed to encode jpeg: %v", err)))
+			return
+		}
+
+		thumbnailBytes, err = os.ReadFile(tmpFile.Name())
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New(fmt.Sprintf("Failed to read %s: %v", tmpFile.Name(), err)))
 			return
 		}
 
@@ -1003,18 +1038,9 @@ func (s *server) SendImage() http.HandlerFunc {
 			JPEGThumbnail: thumbnailBytes,
 		}}
 
-		if t.ContextInfo.StanzaID != nil {
-			if msg.ImageMessage.ContextInfo == nil {
-				msg.ImageMessage.ContextInfo = &waProto.ContextInfo{
-					StanzaID:      proto.String(*t.ContextInfo.StanzaID),
-					Participant:   proto.String(*t.ContextInfo.Participant),
-					QuotedMessage: &waProto.Message{Conversation: proto.String("")},
-				}
-			}
-		}
-
-		if t.ContextInfo.MentionedJID != nil {
-			msg.ImageMessage.ContextInfo.MentionedJID = t.ContextInfo.MentionedJID
+		s.applyContextInfo(userid, recipient, msg, &t.ContextInfo)
+		if t.ViewOnce {
+			msg = viewOnceMessage(msg)
 		}
 
 		resp, err = clientPointer[userid].SendMessage(context.Background(), recipient, msg, whatsmeow.SendRequestExtra{ID: msgid})
@@ -1022,8 +1048,9 @@ func (s *server) SendImage() http.HandlerFunc {
 			s.Respond(w, r, http.StatusInternalServerError, errors.New(fmt.Sprintf("Error sending message: %v", err)))
 			return
 		}
+		s.messages.SaveSent(userid, clientPointer[userid], recipient, resp, msg)
 
-		log.Info().Str("timestamp", fmt.Sprintf("%d", resp.Timestamp)).Str("id", msgid).Msg("Message sent")
+		log.Info().Str("timestamp", fmt.Sprintf("%v", resp.Timestamp)).Str("id", msgid).Msg("Message sent")
 		response := map[string]interface{}{"Details": "Sent", "Timestamp": resp.Timestamp, "Id": msgid}
 		responseJson, err := json.Marshal(response)
 		if err != nil {
@@ -1039,11 +1066,14 @@ func (s *server) SendImage() http.HandlerFunc {
 func (s *server) SendSticker() http.HandlerFunc {
 
 	type stickerStruct struct {
-		Phone        string
-		Sticker      string
-		Id           string
-		PngThumbnail []byte
-		ContextInfo  waProto.ContextInfo
+		Phone         string
+		Sticker       string
+		Id            string
+		PngThumbnail  []byte
+		PackName      string
+		PackPublisher string
+		Emojis        []string
+		ContextInfo   waProto.ContextInfo
 	}
 
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -1058,25 +1088,25 @@ func (s *server) SendSticker() http.HandlerFunc {
 			return
 		}
 
-		decoder := json.NewDecoder(r.Body)
 		var t stickerStruct
-		err := decoder.Decode(&t)
+		upload, err := decodeMediaPayload(r, &t)
 		if err != nil {
-			s.Respond(w, r, http.StatusBadRequest, errors.New("Could not decode Payload"))
+			s.Respond(w, r, http.StatusBadRequest, err)
 			return
 		}
+		defer upload.Remove()
 
 		if t.Phone == "" {
 			s.Respond(w, r, http.StatusBadRequest, errors.New("Missing Phone in Payload"))
 			return
 		}
 
-		if t.Sticker == "" {
+		if t.Sticker == "" && upload == nil {
 			s.Respond(w, r, http.StatusBadRequest, errors.New("Missing Sticker in Payload"))
 			return
 		}
 
-		recipient, err := validateMessageFields(t.Phone, t.ContextInfo.StanzaID, t.ContextInfo.Participant)
+		recipient, err := s.validateMessageFields(clientPointer[userid], t.Phone, t.ContextInfo.StanzaID, t.ContextInfo.Participant)
 		if err != nil {
 			log.Error().Msg(fmt.Sprintf("%s", err))
 			s.Respond(w, r, http.StatusBadRequest, err)
@@ -1092,56 +1122,65 @@ func (s *server) SendSticker() http.HandlerFunc {
 		var uploaded whatsmeow.UploadResponse
 		var filedata []byte
 
-		if t.Sticker[0:4] == "data" {
+		if upload != nil {
+			filedata, err = upload.Bytes()
+			if err != nil {
+				s.Respond(w, r, http.StatusInternalServerError, err)
+				return
+			}
+		} else if strings.HasPrefix(t.Sticker, "data") {
 			dataURL, err := dataurl.DecodeString(t.Sticker)
 			if err != nil {
 				s.Respond(w, r, http.StatusBadRequest, errors.New("Could not decode base64 encoded data from payload"))
 				return
-			} else {
-				filedata = dataURL.Data
-				uploaded, err = clientPointer[userid].Upload(context.Background(), filedata, whatsmeow.MediaImage)
-				if err != nil {
-					s.Respond(w, r, http.StatusInternalServerError, errors.New(fmt.Sprintf("Failed to upload file: %v", err)))
-					return
-				}
 			}
+			filedata = dataURL.Data
 		} else {
 			s.Respond(w, r, http.StatusBadRequest, errors.New("Data should start with \"data:mime/type;base64,\""))
 			return
 		}
 
+		sticker, err := s.transcoder.ToSticker(r.Context(), filedata, &StickerMetadata{
+			PackName:  t.PackName,
+			Publisher: t.PackPublisher,
+			Emojis:    t.Emojis,
+		})
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New(fmt.Sprintf("Failed to convert sticker: %v", err)))
+			return
+		}
+		filedata = sticker.Data
+
+		uploaded, err = clientPointer[userid].Upload(context.Background(), filedata, whatsmeow.MediaImage)
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New(fmt.Sprintf("Failed to upload file: %v", err)))
+			return
+		}
+
 		msg := &waProto.Message{StickerMessage: &waProto.StickerMessage{
 			URL:           proto.String(uploaded.URL),
 			DirectPath:    proto.String(uploaded.DirectPath),
 			MediaKey:      uploaded.MediaKey,
-			Mimetype:      proto.String(http.DetectContentType(filedata)),
+			Mimetype:      proto.String(sticker.MimeType),
 			FileEncSHA256: uploaded.FileEncSHA256,
 			FileSHA256:    uploaded.FileSHA256,
 			FileLength:    proto.Uint64(uint64(len(filedata))),
+			Width:         proto.Uint32(uint32(sticker.Width)),
+			Height:        proto.Uint32(uint32(sticker.Height)),
+			IsAnimated:    proto.Bool(sticker.Animated),
 			PngThumbnail:  t.PngThumbnail,
 		}}
 
-		if t.ContextInfo.StanzaID != nil {
-			msg.ExtendedTextMessage.ContextInfo = &waProto.ContextInfo{
-				StanzaID:      proto.String(*t.ContextInfo.StanzaID),
-				Participant:   proto.String(*t.ContextInfo.Participant),
-				QuotedMessage: &waProto.Message{Conversation: proto.String("")},
-			}
-		}
-		if t.ContextInfo.MentionedJID != nil {
-			if msg.ExtendedTextMessage.ContextInfo == nil {
-				msg.ExtendedTextMessage.ContextInfo = &waProto.ContextInfo{}
-			}
-			msg.ExtendedTextMessage.ContextInfo.MentionedJID = t.ContextInfo.MentionedJID
-		}
+		s.applyContextInfo(userid, recipient, msg, &t.ContextInfo)
 
 		resp, err = clientPointer[userid].SendMessage(context.Background(), recipient, msg, whatsmeow.SendRequestExtra{ID: msgid})
 		if err != nil {
 			s.Respond(w, r, http.StatusInternalServerError, errors.New(fmt.Sprintf("Error sending message: %v", err)))
 			return
 		}
+		s.messages.SaveSent(userid, clientPointer[userid], recipient, resp, msg)
 
-		log.Info().Str("timestamp", fmt.Sprintf("%d", resp.Timestamp)).Str("id", msgid).Msg("Message sent")
+		log.Info().Str("timestamp", fmt.Sprintf("%v", resp.Timestamp)).Str("id", msgid).Msg("Message sent")
 		response := map[string]interface{}{"Details": "Sent", "Timestamp": resp.Timestamp, "Id": msgid}
 		responseJson, err := json.Marshal(response)
 		if err != nil {
@@ -1162,6 +1201,7 @@ func (s *server) SendVideo() http.HandlerFunc {
 		Caption       string
 		Id            string
 		JPEGThumbnail []byte
+		ViewOnce      bool
 		ContextInfo   waProto.ContextInfo
 	}
 
@@ -1177,25 +1217,25 @@ func (s *server) SendVideo() http.HandlerFunc {
 			return
 		}
 
-		decoder := json.NewDecoder(r.Body)
 		var t imageStruct
-		err := decoder.Decode(&t)
+		upload, err := decodeMediaPayload(r, &t)
 		if err != nil {
-			s.Respond(w, r, http.StatusBadRequest, errors.New("Could not decode Payload"))
+			s.Respond(w, r, http.StatusBadRequest, err)
 			return
 		}
+		defer upload.Remove()
 
 		if t.Phone == "" {
 			s.Respond(w, r, http.StatusBadRequest, errors.New("Missing Phone in Payload"))
 			return
 		}
 
-		if t.Video == "" {
+		if t.Video == "" && upload == nil {
 			s.Respond(w, r, http.StatusBadRequest, errors.New("Missing Video in Payload"))
 			return
 		}
 
-		recipient, err := validateMessageFields(t.Phone, t.ContextInfo.StanzaID, t.ContextInfo.Participant)
+		recipient, err := s.validateMessageFields(clientPointer[userid], t.Phone, t.ContextInfo.StanzaID, t.ContextInfo.Participant)
 		if err != nil {
 			log.Error().Msg(fmt.Sprintf("%s", err))
 			s.Respond(w, r, http.StatusBadRequest, err)
@@ -1211,48 +1251,55 @@ func (s *server) SendVideo() http.HandlerFunc {
 		var uploaded whatsmeow.UploadResponse
 		var filedata []byte
 
-		if t.Video[0:4] == "data" {
+		if upload != nil {
+			filedata, err = upload.Bytes()
+			if err != nil {
+				s.Respond(w, r, http.StatusInternalServerError, err)
+				return
+			}
+		} else if strings.HasPrefix(t.Video, "data") {
 			dataURL, err := dataurl.DecodeString(t.Video)
 			if err != nil {
 				s.Respond(w, r, http.StatusBadRequest, errors.New("Could not decode base64 encoded data from payload"))
 				return
-			} else {
-				filedata = dataURL.Data
-				uploaded, err = clientPointer[userid].Upload(context.Background(), filedata, whatsmeow.MediaVideo)
-				if err != nil {
-					s.Respond(w, r, http.StatusInternalServerError, errors.New(fmt.Sprintf("Failed to upload file: %v", err)))
-					return
-				}
 			}
+			filedata = dataURL.Data
 		} else {
 			s.Respond(w, r, http.StatusBadRequest, errors.New("Data should start with \"data:mime/type;base64,\""))
 			return
 		}
 
+		video, err := s.transcoder.ToVideo(r.Context(), filedata)
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New(fmt.Sprintf("Failed to convert video: %v", err)))
+			return
+		}
+		filedata = video.Data
+
+		uploaded, err = clientPointer[userid].Upload(context.Background(), filedata, whatsmeow.MediaVideo)
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New(fmt.Sprintf("Failed to upload file: %v", err)))
+			return
+		}
+
 		msg := &waProto.Message{VideoMessage: &waProto.VideoMessage{
 			Caption:       proto.String(t.Caption),
 			URL:           proto.String(uploaded.URL),
 			DirectPath:    proto.String(uploaded.DirectPath),
 			MediaKey:      uploaded.MediaKey,
-			Mimetype:      proto.String(http.DetectContentType(filedata)),
+			Mimetype:      proto.String(video.MimeType),
 			FileEncSHA256: uploaded.FileEncSHA256,
 			FileSHA256:    uploaded.FileSHA256,
 			FileLength:    proto.Uint64(uint64(len(filedata))),
 			JPEGThumbnail: t.JPEGThumbnail,
+			Seconds:       proto.Uint32(audioSeconds(video.Duration)),
+			Width:         proto.Uint32(uint32(video.Width)),
+			Height:        proto.Uint32(uint32(video.Height)),
 		}}
 
-		if t.ContextInfo.StanzaID != nil {
-			msg.ExtendedTextMessage.ContextInfo = &waProto.ContextInfo{
-				StanzaID:      proto.String(*t.ContextInfo.StanzaID),
-				Participant:   proto.String(*t.ContextInfo.Participant),
-				QuotedMessage: &waProto.Message{Conversation: proto.String("")},
-			}
-		}
-		if t.ContextInfo.MentionedJID != nil {
-			if msg.ExtendedTextMessage.ContextInfo == nil {
-				msg.ExtendedTextMessage.ContextInfo = &waProto.ContextInfo{}
-			}
-			msg.ExtendedTextMessage.ContextInfo.MentionedJID = t.ContextInfo.MentionedJID
+		s.applyContextInfo(userid, recipient, msg, &t.ContextInfo)
+		if t.ViewOnce {
+			msg = viewOnceMessage(msg)
 		}
 
 		resp, err = clientPointer[userid].SendMessage(context.Background(), recipient, msg, whatsmeow.SendRequestExtra{ID: msgid})
@@ -1260,8 +1307,9 @@ func (s *server) SendVideo() http.HandlerFunc {
 			s.Respond(w, r, http.StatusInternalServerError, errors.New(fmt.Sprintf("Error sending message: %v", err)))
 			return
 		}
+		s.messages.SaveSent(userid, clientPointer[userid], recipient, resp, msg)
 
-		log.Info().Str("timestamp", fmt.Sprintf("%d", resp.Timestamp)).Str("id", msgid).Msg("Message sent")
+		log.Info().Str("timestamp", fmt.Sprintf("%v", resp.Timestamp)).Str("id", msgid).Msg("Message sent")
 		response := map[string]interface{}{"Details": "Sent", "Timestamp": resp.Timestamp, "Id": msgid}
 		responseJson, err := json.Marshal(response)
 		if err != nil {
@@ -1317,7 +1365,7 @@ func (s *server) SendContact() http.HandlerFunc {
 			return
 		}
 
-		recipient, err := validateMessageFields(t.Phone, t.ContextInfo.StanzaID, t.ContextInfo.Participant)
+		recipient, err := s.validateMessageFields(clientPointer[userid], t.Phone, t.ContextInfo.StanzaID, t.ContextInfo.Participant)
 		if err != nil {
 			log.Error().Msg(fmt.Sprintf("%s", err))
 			s.Respond(w, r, http.StatusBadRequest, err)
@@ -1335,27 +1383,16 @@ func (s *server) SendContact() http.HandlerFunc {
 			Vcard:       &t.Vcard,
 		}}
 
-		if t.ContextInfo.StanzaID != nil {
-			msg.ExtendedTextMessage.ContextInfo = &waProto.ContextInfo{
-				StanzaID:      proto.String(*t.ContextInfo.StanzaID),
-				Participant:   proto.String(*t.ContextInfo.Participant),
-				QuotedMessage: &waProto.Message{Conversation: proto.String("")},
-			}
-		}
-		if t.ContextInfo.MentionedJID != nil {
-			if msg.ExtendedTextMessage.ContextInfo == nil {
-				msg.ExtendedTextMessage.ContextInfo = &waProto.ContextInfo{}
-			}
-			msg.ExtendedTextMessage.ContextInfo.MentionedJID = t.ContextInfo.MentionedJID
-		}
+		s.applyContextInfo(userid, recipient, msg, &t.ContextInfo)
 
 		resp, err = clientPointer[userid].SendMessage(context.Background(), recipient, msg, whatsmeow.SendRequestExtra{ID: msgid})
 		if err != nil {
 			s.Respond(w, r, http.StatusInternalServerError, errors.New(fmt.Sprintf("Error sending message: %v", err)))
 			return
 		}
+		s.messages.SaveSent(userid, clientPointer[userid], recipient, resp, msg)
 
-		log.Info().Str("timestamp", fmt.Sprintf("%d", resp.Timestamp)).Str("id", msgid).Msg("Message sent")
+		log.Info().Str("timestamp", fmt.Sprintf("%v", resp.Timestamp)).Str("id", msgid).Msg("Message sent")
 		response := map[string]interface{}{"Details": "Sent", "Timestamp": resp.Timestamp, "Id": msgid}
 		responseJson, err := json.Marshal(response)
 		if err != nil {
@@ -1412,7 +1449,7 @@ func (s *server) SendLocation() http.HandlerFunc {
 			return
 		}
 
-		recipient, err := validateMessageFields(t.Phone, t.ContextInfo.StanzaID, t.ContextInfo.Participant)
+		recipient, err := s.validateMessageFields(clientPointer[userid], t.Phone, t.ContextInfo.StanzaID, t.ContextInfo.Participant)
 		if err != nil {
 			log.Error().Msg(fmt.Sprintf("%s", err))
 			s.Respond(w, r, http.StatusBadRequest, err)
@@ -1431,27 +1468,16 @@ func (s *server) SendLocation() http.HandlerFunc {
 			Name:             &t.Name,
 		}}
 
-		if t.ContextInfo.StanzaID != nil {
-			msg.ExtendedTextMessage.ContextInfo = &waProto.ContextInfo{
-				StanzaID:      proto.String(*t.ContextInfo.StanzaID),
-				Participant:   proto.String(*t.ContextInfo.Participant),
-				QuotedMessage: &waProto.Message{Conversation: proto.String("")},
-			}
-		}
-		if t.ContextInfo.MentionedJID != nil {
-			if msg.ExtendedTextMessage.ContextInfo == nil {
-				msg.ExtendedTextMessage.ContextInfo = &waProto.ContextInfo{}
-			}
-			msg.ExtendedTextMessage.ContextInfo.MentionedJID = t.ContextInfo.MentionedJID
-		}
+		s.applyContextInfo(userid, recipient, msg, &t.ContextInfo)
 
 		resp, err = clientPointer[userid].SendMessage(context.Background(), recipient, msg, whatsmeow.SendRequestExtra{ID: msgid})
 		if err != nil {
 			s.Respond(w, r, http.StatusInternalServerError, errors.New(fmt.Sprintf("Error sending message: %v", err)))
 			return
 		}
+		s.messages.SaveSent(userid, clientPointer[userid], recipient, resp, msg)
 
-		log.Info().Str("timestamp", fmt.Sprintf("%d", resp.Timestamp)).Str("id", msgid).Msg("Message sent")
+		log.Info().Str("timestamp", fmt.Sprintf("%v", resp.Timestamp)).Str("id", msgid).Msg("Message sent")
 		response := map[string]interface{}{"Details": "Sent", "Timestamp": resp.Timestamp, "Id": msgid}
 		responseJson, err := json.Marshal(response)
 		if err != nil {
@@ -1518,9 +1544,9 @@ func (s *server) SendButtons() http.HandlerFunc {
 			return
 		}
 
-		recipient, ok := parseJID(t.Phone)
-		if !ok {
-			s.Respond(w, r, http.StatusBadRequest, errors.New("Could not parse Phone"))
+		recipient, err := s.resolveRecipient(clientPointer[userid], t.Phone)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, err)
 			return
 		}
 
@@ -1547,17 +1573,20 @@ func (s *server) SendButtons() http.HandlerFunc {
 			Buttons:     buttons,
 		}
 
-		resp, err = clientPointer[userid].SendMessage(context.Background(), recipient, &waProto.Message{ViewOnceMessage: &waProto.FutureProofMessage{
+		msg := &waProto.Message{ViewOnceMessage: &waProto.FutureProofMessage{
 			Message: &waProto.Message{
 				ButtonsMessage: msg2,
 			},
-		}}, whatsmeow.SendRequestExtra{ID: msgid})
+		}}
+		applyChatExpiration(msg, s.chatExpiration(clientPointer[userid], userid, recipient))
+
+		resp, err = clientPointer[userid].SendMessage(context.Background(), recipient, msg, whatsmeow.SendRequestExtra{ID: msgid})
 		if err != nil {
 			s.Respond(w, r, http.StatusInternalServerError, errors.New(fmt.Sprintf("Error sending message: %v", err)))
 			return
 		}
 
-		log.Info().Str("timestamp", fmt.Sprintf("%d", resp.Timestamp)).Str("id", msgid).Msg("Message sent")
+		log.Info().Str("timestamp", fmt.Sprintf("%v", resp.Timestamp)).Str("id", msgid).Msg("Message sent")
 		response := map[string]interface{}{"Details": "Sent", "Timestamp": resp.Timestamp, "Id": msgid}
 		responseJson, err := json.Marshal(response)
 		if err != nil {
@@ -1642,9 +1671,9 @@ func (s *server) SendList() http.HandlerFunc {
 			s.Respond(w, r, http.StatusBadRequest, errors.New("missing Sections in Payload"))
 			return
 		}
-		recipient, ok := parseJID(t.Phone)
-		if !ok {
-			s.Respond(w, r, http.StatusBadRequest, errors.New("could not parse Phone"))
+		recipient, err := s.resolveRecipient(clientPointer[userid], t.Phone)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, err)
 			return
 		}
 
@@ -1687,18 +1716,21 @@ func (s *server) SendList() http.HandlerFunc {
 			FooterText:  proto.String(t.FooterText),
 		}
 
-		resp, err = clientPointer[userid].SendMessage(context.Background(), recipient, &waProto.Message{
+		msg := &waProto.Message{
 			ViewOnceMessage: &waProto.FutureProofMessage{
 				Message: &waProto.Message{
 					ListMessage: msg1,
 				},
-			}}, whatsmeow.SendRequestExtra{ID: msgid})
+			}}
+		applyChatExpiration(msg, s.chatExpiration(clientPointer[userid], userid, recipient))
+
+		resp, err = clientPointer[userid].SendMessage(context.Background(), recipient, msg, whatsmeow.SendRequestExtra{ID: msgid})
 		if err != nil {
 			s.Respond(w, r, http.StatusInternalServerError, errors.New(fmt.Sprintf("Error sending message: %v", err)))
 			return
 		}
 
-		log.Info().Str("timestamp", fmt.Sprintf("%d", resp.Timestamp)).Str("id", msgid).Msg("Message sent")
+		log.Info().Str("timestamp", fmt.Sprintf("%v", resp.Timestamp)).Str("id", msgid).Msg("Message sent")
 		response := map[string]interface{}{"Details": "Sent", "Timestamp": resp.Timestamp, "Id": msgid}
 		responseJson, err := json.Marshal(response)
 		if err != nil {
@@ -1717,6 +1749,9 @@ func (s *server) SendMessage() http.HandlerFunc {
 		Phone       string
 		Body        string
 		Id          string
+		MentionAll  bool
+		LinkPreview bool
+		Preview     *LinkPreview
 		ContextInfo waProto.ContextInfo
 	}
 
@@ -1755,7 +1790,7 @@ func (s *server) SendMessage() http.HandlerFunc {
 			return
 		}
 
-		recipient, err := validateMessageFields(t.Phone, t.ContextInfo.StanzaID, t.ContextInfo.Participant)
+		recipient, err := s.validateMessageFields(clientPointer[userid], t.Phone, t.ContextInfo.StanzaID, t.ContextInfo.Participant)
 		if err != nil {
 			log.Error().Msg(fmt.Sprintf("%s", err))
 			s.Respond(w, r, http.StatusBadRequest, err)
@@ -1768,6 +1803,12 @@ func (s *server) SendMessage() http.HandlerFunc {
 			msgid = t.Id
 		}
 
+		t.Body, t.ContextInfo.MentionedJID, err = resolveMentions(clientPointer[userid], recipient, t.Body, t.MentionAll, t.ContextInfo.MentionedJID)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, err)
+			return
+		}
+
 		//	msg := &waProto.Message{Conversation: &t.Body}
 
 		msg := &waProto.Message{
@@ -1776,34 +1817,40 @@ func (s *server) SendMessage() http.HandlerFunc {
 			},
 		}
 
-		if t.ContextInfo.StanzaID != nil {
-			msg.ExtendedTextMessage.ContextInfo = &waProto.ContextInfo{
-				StanzaID:      proto.String(*t.ContextInfo.StanzaID),
-				Participant:   proto.String(*t.ContextInfo.Participant),
-				QuotedMessage: &waProto.Message{Conversation: proto.String("")},
+		// preview of the first link, given by the caller or read from the page
+		if t.Preview != nil {
+			if t.Preview.URL == "" {
+				t.Preview.URL = firstURL(t.Body)
 			}
-		}
-		if t.ContextInfo.MentionedJID != nil {
-			if msg.ExtendedTextMessage.ContextInfo == nil {
-				msg.ExtendedTextMessage.ContextInfo = &waProto.ContextInfo{}
+			if t.Preview.URL == "" {
+				s.Respond(w, r, http.StatusBadRequest, errors.New("Missing URL in Preview"))
+				return
 			}
-			msg.ExtendedTextMessage.ContextInfo.MentionedJID = t.ContextInfo.MentionedJID
-		}
-		//aqui
-
-		if t.ContextInfo.Expiration != nil {
-			msg.ExtendedTextMessage.ContextInfo = &waProto.ContextInfo{
-				Expiration: proto.Uint32(uint32(*t.ContextInfo.Expiration)),
+			// clients show the preview on the matched text of the Body
+			if !strings.Contains(t.Body, t.Preview.URL) {
+				s.Respond(w, r, http.StatusBadRequest, errors.New("Preview URL must appear in the Body"))
+				return
+			}
+			applyLinkPreview(msg.ExtendedTextMessage, t.Preview)
+		} else if link := firstURL(t.Body); t.LinkPreview && link != "" {
+			preview, err := fetchLinkPreview(r.Context(), link)
+			if err != nil {
+				log.Warn().Err(err).Str("url", link).Msg("Could not fetch link preview, sending without it")
+			} else {
+				applyLinkPreview(msg.ExtendedTextMessage, preview)
 			}
 		}
 
+		s.applyContextInfo(userid, recipient, msg, &t.ContextInfo)
+
 		resp, err = clientPointer[userid].SendMessage(context.Background(), recipient, msg, whatsmeow.SendRequestExtra{ID: msgid})
 		if err != nil {
 			s.Respond(w, r, http.StatusInternalServerError, errors.New(fmt.Sprintf("Error sending message: %v", err)))
 			return
 		}
+		s.messages.SaveSent(userid, clientPointer[userid], recipient, resp, msg)
 
-		log.Info().Str("timestamp", fmt.Sprintf("%d", resp.Timestamp)).Str("id", msgid).Msg("Message sent")
+		log.Info().Str("timestamp", fmt.Sprintf("%v", resp.Timestamp)).Str("id", msgid).Msg("Message sent")
 		response := map[string]interface{}{"Details": "Sent", "Timestamp": resp.Timestamp, "Id": msgid}
 		responseJson, err := json.Marshal(response)
 		if err != nil {
@@ -2043,6 +2090,62 @@ func (s *server) IsOnWhatsApp() http.HandlerFunc {
 	}
 }
 
+// Resolves a phone, JID, LID or group id to the canonical JID
+func (s *server) ResolveJID() http.HandlerFunc {
+
+	type resolveResponse struct {
+		Query        string
+		JID          string
+		LID          string `json:",omitempty"`
+		IsIn         bool
+		VerifiedName string `json:",omitempty"`
+		Cached       bool
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+		userid, _ := strconv.Atoi(txtid)
+
+		if clientPointer[userid] == nil {
+			s.Respond(w, r, http.StatusInternalServerError, errors.New("No session"))
+			return
+		}
+
+		phone := r.URL.Query().Get("phone")
+		if phone == "" {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("Missing phone parameter"))
+			return
+		}
+
+		resolved, err := s.resolver.Resolve(clientPointer[userid], phone)
+		if err != nil && !errors.Is(err, ErrNotOnWhatsApp) {
+			s.Respond(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		response := resolveResponse{
+			Query:        resolved.Query,
+			JID:          resolved.JID.String(),
+			IsIn:         resolved.IsIn,
+			VerifiedName: resolved.VerifiedName,
+			Cached:       resolved.Cached,
+		}
+		if !resolved.LID.IsEmpty() {
+			response.LID = resolved.LID.String()
+		}
+		responseJson, err := json.Marshal(response)
+
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+		} else {
+			s.Respond(w, r, http.StatusOK, string(responseJson))
+		}
+
+		return
+	}
+}
+
 // Gets avatar info for user
 func (s *server) GetAvatar() http.HandlerFunc {
 
@@ -2113,37 +2216,6 @@ func (s *server) GetAvatar() http.HandlerFunc {
 	}
 }
 
-// Gets all contacts
-func (s *server) GetContacts() http.HandlerFunc {
-
-	return func(w http.ResponseWriter, r *http.Request) {
-
-		txtid := r.Context().Value("userinfo").(Values).Get("Id")
-		userid, _ := strconv.Atoi(txtid)
-
-		if clientPointer[userid] == nil {
-			s.Respond(w, r, http.StatusInternalServerError, errors.New("No session"))
-			return
-		}
-
-		result := map[types.JID]types.ContactInfo{}
-		result, err := clientPointer[userid].Store.Contacts.GetAllContacts()
-		if err != nil {
-			s.Respond(w, r, http.StatusInternalServerError, err)
-			return
-		}
-
-		responseJson, err := json.Marshal(result)
-		if err != nil {
-			s.Respond(w, r, http.StatusInternalServerError, err)
-		} else {
-			s.Respond(w, r, http.StatusOK, string(responseJson))
-		}
-
-		return
-	}
-}
-
 // Sets Chat Presence (typing/paused/recording audio)
 func (s *server) ChatPresence() http.HandlerFunc {
 
@@ -2181,9 +2253,9 @@ func (s *server) ChatPresence() http.HandlerFunc {
 			return
 		}
 
-		jid, ok := parseJID(t.Phone)
-		if !ok {
-			s.Respond(w, r, http.StatusBadRequest, errors.New("Could not parse Phone"))
+		jid, err := s.resolveRecipient(clientPointer[userid], t.Phone)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, err)
 			return
 		}
 
@@ -2244,10 +2316,10 @@ func (s *server) React() http.HandlerFunc {
 			return
 		}
 
-		recipient, ok := parseJID(t.Phone)
-		if !ok {
+		recipient, err := s.resolveRecipient(clientPointer[userid], t.Phone)
+		if err != nil {
 			log.Error().Msg(fmt.Sprintf("%s", err))
-			s.Respond(w, r, http.StatusBadRequest, errors.New("Could not parse Group JID"))
+			s.Respond(w, r, http.StatusBadRequest, err)
 			return
 		}
 
@@ -2281,13 +2353,15 @@ func (s *server) React() http.HandlerFunc {
 			},
 		}
 
+		applyChatExpiration(msg, s.chatExpiration(clientPointer[userid], userid, recipient))
+
 		resp, err = clientPointer[userid].SendMessage(context.Background(), recipient, msg, whatsmeow.SendRequestExtra{ID: msgid})
 		if err != nil {
 			s.Respond(w, r, http.StatusInternalServerError, errors.New(fmt.Sprintf("Error sending message: %v", err)))
 			return
 		}
 
-		log.Info().Str("timestamp", fmt.Sprintf("%d", resp.Timestamp)).Str("id", msgid).Msg("Message sent")
+		log.Info().Str("timestamp", fmt.Sprintf("%v", resp.Timestamp)).Str("id", msgid).Msg("Message sent")
 		response := map[string]interface{}{"Details": "Sent", "Timestamp": resp.Timestamp, "Id": msgid}
 		responseJson, err := json.Marshal(response)
 		if err != nil {
@@ -2357,8 +2431,13 @@ func (s *server) MarkRead() http.HandlerFunc {
 // List groups
 func (s *server) ListGroups() http.HandlerFunc {
 
+	type listedGroup struct {
+		types.GroupInfo
+		Type string // community, announcement or group
+	}
+
 	type GroupCollection struct {
-		Groups []types.GroupInfo
+		Groups []listedGroup
 	}
 
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -2382,7 +2461,7 @@ func (s *server) ListGroups() http.HandlerFunc {
 
 		gc := new(GroupCollection)
 		for _, info := range resp {
-			gc.Groups = append(gc.Groups, *info)
+			gc.Groups = append(gc.Groups, listedGroup{GroupInfo: *info, Type: groupType(info)})
 		}
 
 		responseJson, err := json.Marshal(gc)
@@ -2435,6 +2514,8 @@ func (s *server) GetGroupInfo() http.HandlerFunc {
 			return
 		}
 
+		s.resolver.RememberParticipants(resp.Participants)
+
 		responseJson, err := json.Marshal(resp)
 
 		if err != nil {
@@ -2734,11 +2815,10 @@ func (s *server) AddUser() http.HandlerFunc {
 		}
 
 		// Validate the events input
-		validEvents := []string{"Message", "ReadReceipt", "Presence", "HistorySync", "ChatPresence", "All"}
 		eventList := strings.Split(user.Events, ",")
 		for _, event := range eventList {
 			event = strings.TrimSpace(event)
-			if !Find(validEvents, event) {
+			if !isKnownEventType(event) {
 				s.Respond(w, r, http.StatusBadRequest, errors.New("Invalid event: "+event))
 				return
 			}
@@ -2826,12 +2906,7 @@ func (s *server) Respond(w http.ResponseWriter, r *http.Request, status int, dat
 	}
 }
 
-func validateMessageFields(phone string, stanzaid *string, participant *string) (types.JID, error) {
-
-	recipient, ok := parseJID(phone)
-	if !ok {
-		return types.NewJID("", types.DefaultUserServer), errors.New("Could not parse Phone")
-	}
+func (s *server) validateMessageFields(cli *whatsmeow.Client, phone string, stanzaid *string, participant *string) (types.JID, error) {
 
 	if stanzaid != nil {
 		if participant == nil {
@@ -2845,7 +2920,16 @@ func validateMessageFields(phone string, stanzaid *string, participant *string)
 		}
 	}
 
-	return recipient, nil
+	return s.resolveRecipient(cli, phone)
+}
+
+// resolveRecipient returns the canonical JID for a phone, JID, LID or group id
+func (s *server) resolveRecipient(cli *whatsmeow.Client, phone string) (types.JID, error) {
+	resolved, err := s.resolver.Resolve(cli, phone)
+	if err != nil {
+		return types.NewJID("", types.DefaultUserServer), err
+	}
+	return resolved.JID, nil
 }
 
 func contains(slice []string, item string) bool {
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-resty/resty/v2"
@@ -18,6 +19,26 @@ func Find(slice []string, val string) bool {
     return false
 }
 
+// eventCategory returns the category of an event type, "Group.Joined" -> "Group"
+func eventCategory(eventType string) string {
+	if i := strings.Index(eventType, "."); i > 0 {
+		return eventType[:i]
+	}
+	return eventType
+}
+
+// isKnownEventType validates a subscription, either a category from
+// messageTypes ("Group") or a specific event of that category ("Group.Joined")
+func isKnownEventType(eventType string) bool {
+	return Find(messageTypes, eventType) || Find(messageTypes, eventCategory(eventType))
+}
+
+// isSubscribed checks if an event type was subscribed directly, by its
+// category or with "All"
+func isSubscribed(subscriptions []string, eventType string) bool {
+	return Find(subscriptions, "All") || Find(subscriptions, eventType) || Find(subscriptions, eventCategory(eventType))
+}
+
 // Update entry in User map
 func updateUserInfo(values interface{}, field string, value string) interface{} {
     log.Debug().Str("field",field).Str("value",value).Msg("User info updated")
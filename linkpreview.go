@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"mime"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"golang.org/x/net/html"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// size of the square JPEG thumbnail sent inline with the preview
+	linkPreviewThumbnailSize = 192
+	linkPreviewTimeout       = 10 * time.Second
+)
+
+var linkPreviewURL = regexp.MustCompile(`https?://[^\s<>"']+`)
+
+// LinkPreview holds the fields shown in the preview of a link. Callers can
+// send them explicitly instead of having the server fetch the page.
+type LinkPreview struct {
+	URL         string
+	Title       string
+	Description string
+	// image as a data URL (Image) or fetched from ImageURL
+	Image    string
+	ImageURL string
+	IsVideo  bool
+}
+
+// firstURL returns the first http(s) URL in a text
+func firstURL(text string) string {
+	return strings.TrimRight(linkPreviewURL.FindString(text), ".,;:!?)]}")
+}
+
+// fetchLinkPreview reads the OpenGraph tags of a page, falling back to its
+// title and description meta tag
+func fetchLinkPreview(ctx context.Context, pageURL string) (*LinkPreview, error) {
+	ctx, cancel := context.WithTimeout(ctx, linkPreviewTimeout)
+	defer cancel()
+
+	body, header, err := fetchRemote(ctx, pageURL)
+	if err != nil {
+		return nil, err
+	}
+	if mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type")); mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, errors.New("URL is not an HTML page")
+	}
+
+	preview := &LinkPreview{URL: pageURL}
+	var title, description string
+	tokenizer := html.NewTokenizer(bytes.NewReader(body))
+	inTitle := false
+parse:
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			break parse
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			switch token.Data {
+			case "body":
+				break parse
+			case "title":
+				inTitle = true
+			case "meta":
+				var property, content string
+				for _, attr := range token.Attr {
+					switch attr.Key {
+					case "property", "name":
+						property = strings.ToLower(attr.Val)
+					case "content":
+						content = strings.TrimSpace(attr.Val)
+					}
+				}
+				switch property {
+				case "og:title":
+					preview.Title = content
+				case "og:description":
+					preview.Description = content
+				case "og:image", "og:image:url", "og:image:secure_url":
+					if preview.ImageURL == "" {
+						preview.ImageURL = content
+					}
+				case "og:type":
+					preview.IsVideo = strings.HasPrefix(content, "video")
+				case "description":
+					description = content
+				}
+			}
+		case html.TextToken:
+			if inTitle {
+				title += string(tokenizer.Text())
+			}
+		case html.EndTagToken:
+			if tokenizer.Token().Data == "head" {
+				break parse
+			}
+			inTitle = false
+		}
+	}
+
+	if preview.Title == "" {
+		preview.Title = strings.TrimSpace(title)
+	}
+	if preview.Description == "" {
+		preview.Description = description
+	}
+	// og:image may be relative to the page
+	if preview.ImageURL != "" {
+		if base, err := url.Parse(pageURL); err == nil {
+			if ref, err := base.Parse(preview.ImageURL); err == nil {
+				preview.ImageURL = ref.String()
+			}
+		}
+	}
+	if preview.Title == "" && preview.Description == "" && preview.ImageURL == "" {
+		return nil, errors.New("page has no title, description or image")
+	}
+	return preview, nil
+}
+
+// applyLinkPreview fills the preview fields of a text message. A missing or
+// broken image only leaves the preview without a thumbnail.
+func applyLinkPreview(msg *waProto.ExtendedTextMessage, preview *LinkPreview) {
+	msg.MatchedText = proto.String(preview.URL)
+	msg.Title = proto.String(preview.Title)
+	msg.Description = proto.String(preview.Description)
+	msg.PreviewType = waProto.ExtendedTextMessage_NONE.Enum()
+	if preview.IsVideo {
+		msg.PreviewType = waProto.ExtendedTextMessage_VIDEO.Enum()
+	}
+
+	if preview.Image == "" && preview.ImageURL == "" {
+		return
+	}
+	image, err := statusMediaData(preview.Image, preview.ImageURL)
+	if err != nil {
+		log.Warn().Err(err).Str("url", preview.URL).Msg("Could not get link preview image")
+		return
+	}
+	thumbnail, err := gerarImagemQuadrada(image, linkPreviewThumbnailSize)
+	if err != nil {
+		log.Warn().Err(err).Str("url", preview.URL).Msg("Could not make link preview thumbnail")
+		return
+	}
+	msg.JPEGThumbnail = thumbnail
+}
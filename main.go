@@ -26,10 +26,13 @@ import (
 )
 
 type server struct {
-	db     *sqlx.DB
-	router *mux.Router
-	exPath string
-	r2Config R2Config
+	db         *sqlx.DB
+	router     *mux.Router
+	exPath     string
+	r2Config   R2Config
+	transcoder *MediaTranscoder
+	resolver   *JIDResolver
+	messages   *MessageStore
 }
 
 type R2Config struct {
@@ -162,9 +165,14 @@ func main() {
 			BucketName: "pa2025dev",
 			CustomDomain: "pa2025dev-r2.possoatender.com", // opcional
 		},
+		transcoder: NewMediaTranscoder(),
+		resolver:   NewJIDResolver(db),
+		messages:   NewMessageStore(db),
 	}
 	s.routes()
 
+	go s.messages.PruneLoop()
+
 	s.connectOnStartup()
 
 	srv := &http.Server{
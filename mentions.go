@@ -0,0 +1,222 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"go.mau.fi/whatsmeow"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// mentionPlaceholder matches "@{5491155554444}" or "@{+54 9 11 5555-4444}"
+var mentionPlaceholder = regexp.MustCompile(`@\{([^}]+)\}`)
+
+func onlyDigits(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, value)
+}
+
+// resolveMentions rewrites "@{phone}" placeholders into "@number" and returns
+// the JIDs to be set in ContextInfo.MentionedJID, merged with the ones the
+// caller already sent. In groups placeholders are resolved against the
+// participants and mentionAll mentions every participant.
+func resolveMentions(cli *whatsmeow.Client, chat types.JID, text string, mentionAll bool, mentioned []string) (string, []string, error) {
+	hasPlaceholders := mentionPlaceholder.MatchString(text)
+	if !mentionAll && !hasPlaceholders {
+		return text, mentioned, nil
+	}
+
+	isGroup := chat.Server == types.GroupServer
+	if mentionAll && !isGroup {
+		return text, nil, errors.New("mentionAll can only be used when sending to groups")
+	}
+
+	var participants []types.GroupParticipant
+	if isGroup {
+		info, err := cli.GetGroupInfo(chat)
+		if err != nil {
+			return text, nil, fmt.Errorf("Could not get group participants: %v", err)
+		}
+		participants = info.Participants
+	}
+
+	seen := make(map[string]bool)
+	result := make([]string, 0, len(mentioned))
+	add := func(jid string) {
+		if !seen[jid] {
+			seen[jid] = true
+			result = append(result, jid)
+		}
+	}
+	for _, jid := range mentioned {
+		add(jid)
+	}
+
+	var unresolved []string
+	text = mentionPlaceholder.ReplaceAllStringFunc(text, func(match string) string {
+		phone := onlyDigits(mentionPlaceholder.FindStringSubmatch(match)[1])
+		if phone == "" {
+			unresolved = append(unresolved, match)
+			return match
+		}
+		jid := types.NewJID(phone, types.DefaultUserServer)
+		if isGroup {
+			found := false
+			for _, participant := range participants {
+				if participant.JID.User == phone || participant.LID.User == phone {
+					jid, found = participant.JID, true
+					break
+				}
+			}
+			if !found {
+				unresolved = append(unresolved, match)
+				return match
+			}
+		}
+		add(jid.String())
+		return "@" + jid.User
+	})
+	if len(unresolved) > 0 {
+		return text, nil, fmt.Errorf("Could not resolve mentions: %s", strings.Join(unresolved, ", "))
+	}
+
+	if mentionAll {
+		for _, participant := range participants {
+			add(participant.JID.String())
+		}
+	}
+	return text, result, nil
+}
+
+// contextInfoFor returns the ContextInfo of the inner message that carries
+// it, creating it when missing. Returns nil for unsupported message types.
+func contextInfoFor(msg *waProto.Message) *waProto.ContextInfo {
+	switch {
+	case msg.ExtendedTextMessage != nil:
+		if msg.ExtendedTextMessage.ContextInfo == nil {
+			msg.ExtendedTextMessage.ContextInfo = &waProto.ContextInfo{}
+		}
+		return msg.ExtendedTextMessage.ContextInfo
+	case msg.ImageMessage != nil:
+		if msg.ImageMessage.ContextInfo == nil {
+			msg.ImageMessage.ContextInfo = &waProto.ContextInfo{}
+		}
+		return msg.ImageMessage.ContextInfo
+	case msg.VideoMessage != nil:
+		if msg.VideoMessage.ContextInfo == nil {
+			msg.VideoMessage.ContextInfo = &waProto.ContextInfo{}
+		}
+		return msg.VideoMessage.ContextInfo
+	case msg.AudioMessage != nil:
+		if msg.AudioMessage.ContextInfo == nil {
+			msg.AudioMessage.ContextInfo = &waProto.ContextInfo{}
+		}
+		return msg.AudioMessage.ContextInfo
+	case msg.DocumentMessage != nil:
+		if msg.DocumentMessage.ContextInfo == nil {
+			msg.DocumentMessage.ContextInfo = &waProto.ContextInfo{}
+		}
+		return msg.DocumentMessage.ContextInfo
+	case msg.StickerMessage != nil:
+		if msg.StickerMessage.ContextInfo == nil {
+			msg.StickerMessage.ContextInfo = &waProto.ContextInfo{}
+		}
+		return msg.StickerMessage.ContextInfo
+	case msg.LocationMessage != nil:
+		if msg.LocationMessage.ContextInfo == nil {
+			msg.LocationMessage.ContextInfo = &waProto.ContextInfo{}
+		}
+		return msg.LocationMessage.ContextInfo
+	case msg.ContactMessage != nil:
+		if msg.ContactMessage.ContextInfo == nil {
+			msg.ContactMessage.ContextInfo = &waProto.ContextInfo{}
+		}
+		return msg.ContactMessage.ContextInfo
+	}
+	return nil
+}
+
+// mentionsJID checks if an incoming message mentions the given user. Groups
+// addressed by LID mention the user's LID instead of the phone number, so
+// both can be given.
+func mentionsJID(msg *waProto.Message, users ...types.JID) bool {
+	if msg == nil {
+		return false
+	}
+	msg, _ = unwrapMessage(msg)
+	for _, jid := range messageContextInfo(msg).GetMentionedJID() {
+		parsed, err := types.ParseJID(jid)
+		if err != nil {
+			continue
+		}
+		for _, user := range users {
+			if user.User != "" && parsed.User == user.User {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ownLIDCache keeps the LID of the connected number once it is learned, so
+// incoming mentions don't need a database lookup on every message
+type ownLIDCache struct {
+	mu       sync.Mutex
+	lid      types.JID
+	lookedUp bool
+}
+
+// get returns the cached LID, reading it from the resolver while unknown
+func (c *ownLIDCache) get(resolver *JIDResolver, me types.JID) types.JID {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lid.User == "" {
+		c.lid = resolver.LIDFor(me)
+	}
+	return c.lid
+}
+
+// rememberOwnLID learns the LID of the connected number from the groups it
+// is in, so mentions in groups addressed by LID are recognized. The groups
+// are fetched at most once per client, not on every reconnect.
+func rememberOwnLID(cli *whatsmeow.Client, resolver *JIDResolver, cache *ownLIDCache) {
+	if cli.Store.ID == nil {
+		return
+	}
+	me := cli.Store.ID.ToNonAD()
+	if cache.get(resolver, me).User != "" {
+		return
+	}
+	cache.mu.Lock()
+	if cache.lookedUp {
+		cache.mu.Unlock()
+		return
+	}
+	cache.lookedUp = true
+	cache.mu.Unlock()
+
+	groups, err := cli.GetJoinedGroups()
+	if err != nil {
+		log.Warn().Err(err).Msg("Could not get joined groups to learn own LID")
+		return
+	}
+	for _, group := range groups {
+		for _, participant := range group.Participants {
+			if participant.JID.User == me.User && participant.LID.User != "" {
+				resolver.RememberLID(me, participant.LID)
+				cache.mu.Lock()
+				cache.lid = participant.LID.ToNonAD()
+				cache.mu.Unlock()
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"encoding/json"
+
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// MessageContent is the normalized content of a message, sent as "content"
+// in Message webhooks. MessageType is one of the names returned by
+// messageType and tells which of Media, Location, Contacts, Reaction and Poll
+// is set, Reply is set for "reply".
+type MessageContent struct {
+	MessageType       string            `json:"messageType"`
+	Text              string            `json:"text,omitempty"`
+	Caption           string            `json:"caption,omitempty"`
+	QuotedID          string            `json:"quotedId,omitempty"`
+	QuotedParticipant string            `json:"quotedParticipant,omitempty"`
+	Mentions          []string          `json:"mentions,omitempty"`
+	IsForwarded       bool              `json:"isForwarded"`
+	IsEphemeral       bool              `json:"isEphemeral"`
+	IsViewOnce        bool              `json:"isViewOnce"`
+	IsEdited          bool              `json:"isEdited"`
+	EditedID          string            `json:"editedId,omitempty"`
+	Media             *MediaContent     `json:"media,omitempty"`
+	Location          *LocationContent  `json:"location,omitempty"`
+	Contacts          []ContactContent  `json:"contacts,omitempty"`
+	Reaction          *ReactionContent  `json:"reaction,omitempty"`
+	Poll              *PollContent      `json:"poll,omitempty"`
+	Reply             *InteractiveReply `json:"reply,omitempty"`
+}
+
+// MediaContent describes an attachment. The fields use the names taken by
+// POST /chat/download, so it can be sent there as it is.
+type MediaContent struct {
+	MessageType   string `json:"messageType"`
+	URL           string `json:"URL"`
+	DirectPath    string `json:"directPath"`
+	MediaKey      []byte `json:"mediaKey"`
+	Mimetype      string `json:"mimetype"`
+	FileEncSHA256 []byte `json:"fileEncSHA256"`
+	FileSHA256    []byte `json:"fileSHA256"`
+	FileLength    uint64 `json:"fileLength"`
+	FileName      string `json:"fileName,omitempty"`
+	Seconds       uint32 `json:"seconds,omitempty"`
+	PTT           bool   `json:"ptt,omitempty"`
+}
+
+// LocationContent is a fixed or live location
+type LocationContent struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Name      string  `json:"name,omitempty"`
+	Address   string  `json:"address,omitempty"`
+	Live      bool    `json:"live"`
+}
+
+// ContactContent is a shared contact card
+type ContactContent struct {
+	DisplayName string `json:"displayName"`
+	VCard       string `json:"vcard"`
+}
+
+// ReactionContent is a reaction to another message, an empty text removes it
+type ReactionContent struct {
+	MessageID string `json:"messageId"`
+	Text      string `json:"text"`
+}
+
+// PollContent is a new poll, or a vote on the poll with MessageID
+type PollContent struct {
+	Name            string   `json:"name,omitempty"`
+	Options         []string `json:"options,omitempty"`
+	SelectableCount uint32   `json:"selectableCount,omitempty"`
+	MessageID       string   `json:"messageId,omitempty"`
+}
+
+// InteractiveReply is the choice made on buttons, a list or an interactive
+// message. Kind is button, list, template or nativeFlow.
+type InteractiveReply struct {
+	Kind        string `json:"kind"`
+	ID          string `json:"id"`
+	Text        string `json:"text"`
+	Description string `json:"description,omitempty"`
+	MessageID   string `json:"messageId"`
+	// name and raw parameters of native flow replies
+	Name   string `json:"name,omitempty"`
+	Params string `json:"params,omitempty"`
+}
+
+// messageWrappers tells which wrappers unwrapMessage removed
+type messageWrappers struct {
+	Ephemeral bool
+	ViewOnce  bool
+	Edited    bool
+	// id of the edited message, when the edit came as a protocol message
+	EditedID string
+}
+
+// unwrapMessage returns the message inside the ephemeral, view once, edit,
+// device sent and document with caption wrappers, which can be nested
+func unwrapMessage(msg *waProto.Message) (*waProto.Message, messageWrappers) {
+	var wrappers messageWrappers
+	for msg != nil {
+		switch {
+		case msg.GetDeviceSentMessage().GetMessage() != nil:
+			msg = msg.GetDeviceSentMessage().GetMessage()
+		case msg.GetEphemeralMessage().GetMessage() != nil:
+			msg = msg.GetEphemeralMessage().GetMessage()
+			wrappers.Ephemeral = true
+		case msg.GetViewOnceMessage().GetMessage() != nil:
+			msg = msg.GetViewOnceMessage().GetMessage()
+			wrappers.ViewOnce = true
+		case msg.GetViewOnceMessageV2().GetMessage() != nil:
+			msg = msg.GetViewOnceMessageV2().GetMessage()
+			wrappers.ViewOnce = true
+		case msg.GetViewOnceMessageV2Extension().GetMessage() != nil:
+			msg = msg.GetViewOnceMessageV2Extension().GetMessage()
+			wrappers.ViewOnce = true
+		case msg.GetDocumentWithCaptionMessage().GetMessage() != nil:
+			msg = msg.GetDocumentWithCaptionMessage().GetMessage()
+		case msg.GetEditedMessage().GetMessage() != nil:
+			msg = msg.GetEditedMessage().GetMessage()
+			wrappers.Edited = true
+		case msg.GetProtocolMessage().GetType() == waProto.ProtocolMessage_MESSAGE_EDIT && msg.GetProtocolMessage().GetEditedMessage() != nil:
+			wrappers.Edited = true
+			wrappers.EditedID = msg.GetProtocolMessage().GetKey().GetID()
+			msg = msg.GetProtocolMessage().GetEditedMessage()
+		default:
+			return msg, wrappers
+		}
+	}
+	return msg, wrappers
+}
+
+// messageContextInfo returns the ContextInfo of an unwrapped message, or nil.
+// Unlike contextInfoFor it never modifies the message.
+func messageContextInfo(msg *waProto.Message) *waProto.ContextInfo {
+	switch {
+	case msg.GetExtendedTextMessage() != nil:
+		return msg.GetExtendedTextMessage().GetContextInfo()
+	case msg.GetImageMessage() != nil:
+		return msg.GetImageMessage().GetContextInfo()
+	case msg.GetVideoMessage() != nil:
+		return msg.GetVideoMessage().GetContextInfo()
+	case msg.GetAudioMessage() != nil:
+		return msg.GetAudioMessage().GetContextInfo()
+	case msg.GetDocumentMessage() != nil:
+		return msg.GetDocumentMessage().GetContextInfo()
+	case msg.GetStickerMessage() != nil:
+		return msg.GetStickerMessage().GetContextInfo()
+	case msg.GetLocationMessage() != nil:
+		return msg.GetLocationMessage().GetContextInfo()
+	case msg.GetLiveLocationMessage() != nil:
+		return msg.GetLiveLocationMessage().GetContextInfo()
+	case msg.GetContactMessage() != nil:
+		return msg.GetContactMessage().GetContextInfo()
+	case msg.GetContactsArrayMessage() != nil:
+		return msg.GetContactsArrayMessage().GetContextInfo()
+	case msg.GetPollCreationMessage() != nil:
+		return msg.GetPollCreationMessage().GetContextInfo()
+	case msg.GetPollCreationMessageV3() != nil:
+		return msg.GetPollCreationMessageV3().GetContextInfo()
+	case msg.GetButtonsResponseMessage() != nil:
+		return msg.GetButtonsResponseMessage().GetContextInfo()
+	case msg.GetListResponseMessage() != nil:
+		return msg.GetListResponseMessage().GetContextInfo()
+	case msg.GetTemplateButtonReplyMessage() != nil:
+		return msg.GetTemplateButtonReplyMessage().GetContextInfo()
+	case msg.GetInteractiveResponseMessage() != nil:
+		return msg.GetInteractiveResponseMessage().GetContextInfo()
+	}
+	return nil
+}
+
+// extractMessageContent unwraps a message and normalizes its content
+func extractMessageContent(msg *waProto.Message) MessageContent {
+	msg, wrappers := unwrapMessage(msg)
+	content := MessageContent{
+		MessageType: messageType(msg),
+		IsEphemeral: wrappers.Ephemeral,
+		IsViewOnce:  wrappers.ViewOnce,
+		IsEdited:    wrappers.Edited,
+		EditedID:    wrappers.EditedID,
+	}
+
+	if contextInfo := messageContextInfo(msg); contextInfo != nil {
+		content.QuotedID = contextInfo.GetStanzaID()
+		content.QuotedParticipant = contextInfo.GetParticipant()
+		content.Mentions = contextInfo.GetMentionedJID()
+		content.IsForwarded = contextInfo.GetIsForwarded()
+	}
+
+	switch {
+	case msg == nil:
+	case msg.Conversation != nil:
+		content.Text = msg.GetConversation()
+	case msg.ExtendedTextMessage != nil:
+		content.Text = msg.GetExtendedTextMessage().GetText()
+	case msg.ImageMessage != nil:
+		m := msg.GetImageMessage()
+		content.Caption = m.GetCaption()
+		content.Media = &MediaContent{MessageType: "imageMessage", URL: m.GetURL(), DirectPath: m.GetDirectPath(), MediaKey: m.GetMediaKey(),
+			Mimetype: m.GetMimetype(), FileEncSHA256: m.GetFileEncSHA256(), FileSHA256: m.GetFileSHA256(), FileLength: m.GetFileLength()}
+	case msg.VideoMessage != nil:
+		m := msg.GetVideoMessage()
+		content.Caption = m.GetCaption()
+		content.Media = &MediaContent{MessageType: "videoMessage", URL: m.GetURL(), DirectPath: m.GetDirectPath(), MediaKey: m.GetMediaKey(),
+			Mimetype: m.GetMimetype(), FileEncSHA256: m.GetFileEncSHA256(), FileSHA256: m.GetFileSHA256(), FileLength: m.GetFileLength(),
+			Seconds: m.GetSeconds()}
+	case msg.AudioMessage != nil:
+		m := msg.GetAudioMessage()
+		content.Media = &MediaContent{MessageType: "audioMessage", URL: m.GetURL(), DirectPath: m.GetDirectPath(), MediaKey: m.GetMediaKey(),
+			Mimetype: m.GetMimetype(), FileEncSHA256: m.GetFileEncSHA256(), FileSHA256: m.GetFileSHA256(), FileLength: m.GetFileLength(),
+			Seconds: m.GetSeconds(), PTT: m.GetPTT()}
+	case msg.DocumentMessage != nil:
+		m := msg.GetDocumentMessage()
+		content.Caption = m.GetCaption()
+		content.Media = &MediaContent{MessageType: "documentMessage", URL: m.GetURL(), DirectPath: m.GetDirectPath(), MediaKey: m.GetMediaKey(),
+			Mimetype: m.GetMimetype(), FileEncSHA256: m.GetFileEncSHA256(), FileSHA256: m.GetFileSHA256(), FileLength: m.GetFileLength(),
+			FileName: m.GetFileName()}
+	case msg.StickerMessage != nil:
+		m := msg.GetStickerMessage()
+		content.Media = &MediaContent{MessageType: "stickerMessage", URL: m.GetURL(), DirectPath: m.GetDirectPath(), MediaKey: m.GetMediaKey(),
+			Mimetype: m.GetMimetype(), FileEncSHA256: m.GetFileEncSHA256(), FileSHA256: m.GetFileSHA256(), FileLength: m.GetFileLength()}
+	case msg.LocationMessage != nil:
+		m := msg.GetLocationMessage()
+		content.Location = &LocationContent{Latitude: m.GetDegreesLatitude(), Longitude: m.GetDegreesLongitude(), Name: m.GetName(), Address: m.GetAddress()}
+	case msg.LiveLocationMessage != nil:
+		m := msg.GetLiveLocationMessage()
+		content.Caption = m.GetCaption()
+		content.Location = &LocationContent{Latitude: m.GetDegreesLatitude(), Longitude: m.GetDegreesLongitude(), Live: true}
+	case msg.ContactMessage != nil:
+		content.Contacts = []ContactContent{{DisplayName: msg.GetContactMessage().GetDisplayName(), VCard: msg.GetContactMessage().GetVcard()}}
+	case msg.ContactsArrayMessage != nil:
+		for _, contact := range msg.GetContactsArrayMessage().GetContacts() {
+			content.Contacts = append(content.Contacts, ContactContent{DisplayName: contact.GetDisplayName(), VCard: contact.GetVcard()})
+		}
+	case msg.ReactionMessage != nil:
+		content.Reaction = &ReactionContent{MessageID: msg.GetReactionMessage().GetKey().GetID(), Text: msg.GetReactionMessage().GetText()}
+	case msg.PollCreationMessage != nil, msg.PollCreationMessageV3 != nil:
+		m := msg.GetPollCreationMessage()
+		if m == nil {
+			m = msg.GetPollCreationMessageV3()
+		}
+		poll := &PollContent{Name: m.GetName(), SelectableCount: m.GetSelectableOptionsCount()}
+		for _, option := range m.GetOptions() {
+			poll.Options = append(poll.Options, option.GetOptionName())
+		}
+		content.Poll = poll
+	case msg.PollUpdateMessage != nil:
+		// votes are encrypted, only the poll they belong to is known here
+		content.Poll = &PollContent{MessageID: msg.GetPollUpdateMessage().GetPollCreationMessageKey().GetID()}
+	default:
+		content.Reply = interactiveReply(msg)
+	}
+	return content
+}
+
+// interactiveReply decodes the reply to buttons, lists and interactive
+// messages, or returns nil for other messages
+func interactiveReply(msg *waProto.Message) *InteractiveReply {
+	var reply *InteractiveReply
+	switch {
+	case msg.GetButtonsResponseMessage() != nil:
+		m := msg.GetButtonsResponseMessage()
+		reply = &InteractiveReply{Kind: "button", ID: m.GetSelectedButtonID(), Text: m.GetSelectedDisplayText()}
+	case msg.GetListResponseMessage() != nil:
+		m := msg.GetListResponseMessage()
+		reply = &InteractiveReply{Kind: "list", ID: m.GetSingleSelectReply().GetSelectedRowID(), Text: m.GetTitle(), Description: m.GetDescription()}
+	case msg.GetTemplateButtonReplyMessage() != nil:
+		m := msg.GetTemplateButtonReplyMessage()
+		reply = &InteractiveReply{Kind: "template", ID: m.GetSelectedID(), Text: m.GetSelectedDisplayText()}
+	case msg.GetInteractiveResponseMessage() != nil:
+		m := msg.GetInteractiveResponseMessage()
+		flow := m.GetNativeFlowResponseMessage()
+		reply = &InteractiveReply{Kind: "nativeFlow", Text: m.GetBody().GetText(), Name: flow.GetName(), Params: flow.GetParamsJSON()}
+		// quick replies send the id of the button as {"id":"..."}
+		var params struct {
+			ID string `json:"id"`
+		}
+		if json.Unmarshal([]byte(flow.GetParamsJSON()), &params) == nil {
+			reply.ID = params.ID
+		}
+	default:
+		return nil
+	}
+	reply.MessageID = messageContextInfo(msg).GetStanzaID()
+	return reply
+}
+
+// eventMessageContent normalizes the content of an incoming message. whatsmeow
+// already removed the outer wrappers, so their flags are taken from the event.
+func eventMessageContent(evt *events.Message) MessageContent {
+	content := extractMessageContent(evt.Message)
+	content.IsEphemeral = content.IsEphemeral || evt.IsEphemeral
+	content.IsViewOnce = content.IsViewOnce || evt.IsViewOnce
+	content.IsEdited = content.IsEdited || evt.IsEdit
+	return content
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"go.mau.fi/whatsmeow"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+// MessageStore keeps the messages sent and received by each user in the
+// messages table, so they can be looked up later by chat and id.
+type MessageStore struct {
+	db        *sqlx.DB
+	Retention time.Duration
+}
+
+// NewMessageStore reads MESSAGE_RETENTION_DAYS (default 30)
+func NewMessageStore(db *sqlx.DB) *MessageStore {
+	store := &MessageStore{db: db, Retention: 30 * 24 * time.Hour}
+	if v, err := strconv.Atoi(os.Getenv("MESSAGE_RETENTION_DAYS")); err == nil && v > 0 {
+		store.Retention = time.Duration(v) * 24 * time.Hour
+	}
+	return store
+}
+
+// StoredMessage is a row of the messages table
+type StoredMessage struct {
+	UserID    int        `db:"user_id" json:"-"`
+	Chat      string     `db:"chat"`
+	ID        string     `db:"id"`
+	Sender    string     `db:"sender"`
+	FromMe    bool       `db:"from_me"`
+	Type      string     `db:"type"`
+	PushName  string     `db:"push_name"`
+	Timestamp time.Time  `db:"timestamp"`
+	Message   []byte     `db:"message" json:"-"`
+	ViewedAt  *time.Time `db:"viewed_at" json:",omitempty"`
+}
+
+// Decode returns the stored message content
+func (sm *StoredMessage) Decode() (*waProto.Message, error) {
+	msg := &waProto.Message{}
+	err := proto.Unmarshal(sm.Message, msg)
+	return msg, err
+}
+
+// messageType returns a short name for the content of a message
+func messageType(msg *waProto.Message) string {
+	switch {
+	case msg == nil:
+		return ""
+	case msg.Conversation != nil, msg.ExtendedTextMessage != nil:
+		return "text"
+	case msg.ImageMessage != nil:
+		return "image"
+	case msg.VideoMessage != nil:
+		return "video"
+	case msg.AudioMessage != nil:
+		return "audio"
+	case msg.DocumentMessage != nil, msg.DocumentWithCaptionMessage != nil:
+		return "document"
+	case msg.StickerMessage != nil:
+		return "sticker"
+	case msg.LocationMessage != nil, msg.LiveLocationMessage != nil:
+		return "location"
+	case msg.ContactMessage != nil, msg.ContactsArrayMessage != nil:
+		return "contact"
+	case msg.ReactionMessage != nil:
+		return "reaction"
+	case msg.PollCreationMessage != nil, msg.PollCreationMessageV3 != nil, msg.PollUpdateMessage != nil:
+		return "poll"
+	case msg.ProtocolMessage != nil:
+		return "protocol"
+	case msg.CallLogMesssage != nil:
+		return "call"
+	case msg.ButtonsResponseMessage != nil, msg.ListResponseMessage != nil, msg.TemplateButtonReplyMessage != nil, msg.InteractiveResponseMessage != nil:
+		return "reply"
+	case msg.InteractiveMessage != nil, msg.ButtonsMessage != nil, msg.ListMessage != nil:
+		return "interactive"
+	}
+	return "other"
+}
+
+// storedMessageType is the type of the message inside any wrappers
+func storedMessageType(msg *waProto.Message) string {
+	inner, _ := unwrapMessage(msg)
+	return messageType(inner)
+}
+
+// Save stores a message, keeping the first copy when it is received twice
+func (ms *MessageStore) Save(userID int, info types.MessageInfo, msg *waProto.Message) {
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		log.Warn().Err(err).Str("id", info.ID).Msg("Could not encode message for the message store")
+		return
+	}
+	_, err = ms.db.Exec(`INSERT INTO messages (user_id, chat, id, sender, from_me, type, push_name, timestamp, message)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) ON CONFLICT (user_id, chat, id) DO NOTHING`,
+		userID, info.Chat.ToNonAD().String(), info.ID, info.Sender.ToNonAD().String(), info.IsFromMe,
+		storedMessageType(msg), info.PushName, info.Timestamp.UTC(), data)
+	if err != nil {
+		log.Warn().Err(err).Str("id", info.ID).Msg("Could not write message store")
+	}
+}
+
+// Upsert stores a message, replacing the content of a stored one
+func (ms *MessageStore) Upsert(userID int, info types.MessageInfo, msg *waProto.Message) {
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		log.Warn().Err(err).Str("id", info.ID).Msg("Could not encode message for the message store")
+		return
+	}
+	_, err = ms.db.Exec(`INSERT INTO messages (user_id, chat, id, sender, from_me, type, push_name, timestamp, message)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) ON CONFLICT (user_id, chat, id) DO UPDATE SET message=EXCLUDED.message`,
+		userID, info.Chat.ToNonAD().String(), info.ID, info.Sender.ToNonAD().String(), info.IsFromMe,
+		storedMessageType(msg), info.PushName, info.Timestamp.UTC(), data)
+	if err != nil {
+		log.Warn().Err(err).Str("id", info.ID).Msg("Could not write message store")
+	}
+}
+
+// SaveSent stores a message sent through the API
+func (ms *MessageStore) SaveSent(userID int, cli *whatsmeow.Client, chat types.JID, resp whatsmeow.SendResponse, msg *waProto.Message) {
+	info := types.MessageInfo{
+		MessageSource: types.MessageSource{Chat: chat, IsFromMe: true, IsGroup: chat.Server == types.GroupServer},
+		ID:            resp.ID,
+		PushName:      cli.Store.PushName,
+		Timestamp:     resp.Timestamp,
+	}
+	if cli.Store.ID != nil {
+		info.Sender = *cli.Store.ID
+	}
+	ms.Save(userID, info, msg)
+}
+
+// Get returns a stored message, or sql.ErrNoRows
+func (ms *MessageStore) Get(userID int, chat types.JID, id string) (*StoredMessage, error) {
+	var sm StoredMessage
+	err := ms.db.Get(&sm, "SELECT * FROM messages WHERE user_id=$1 AND chat=$2 AND id=$3", userID, chat.ToNonAD().String(), id)
+	if err != nil {
+		return nil, err
+	}
+	return &sm, nil
+}
+
+// Recent returns the messages of a chat since the given time, newest first.
+// Without senders it returns messages from everyone.
+func (ms *MessageStore) Recent(userID int, chat types.JID, senders []string, since time.Time, limit int) ([]StoredMessage, error) {
+	messages := []StoredMessage{}
+	err := ms.db.Select(&messages, `SELECT * FROM messages WHERE user_id=$1 AND chat=$2 AND timestamp>=$3 AND (cardinality($4::text[])=0 OR sender=ANY($4))
+		ORDER BY timestamp DESC LIMIT $5`, userID, chat.ToNonAD().String(), since.UTC(), pq.Array(senders), limit)
+	return messages, err
+}
+
+// MarkViewed records that a message was viewed by us
+func (ms *MessageStore) MarkViewed(userID int, chat types.JID, id string) error {
+	_, err := ms.db.Exec("UPDATE messages SET viewed_at=NOW() WHERE user_id=$1 AND chat=$2 AND id=$3 AND viewed_at IS NULL",
+		userID, chat.ToNonAD().String(), id)
+	return err
+}
+
+// Prune deletes messages older than the retention period
+func (ms *MessageStore) Prune() {
+	result, err := ms.db.Exec("DELETE FROM messages WHERE timestamp < $1", time.Now().Add(-ms.Retention).UTC())
+	if err != nil {
+		log.Warn().Err(err).Msg("Could not prune message store")
+		return
+	}
+	if deleted, _ := result.RowsAffected(); deleted > 0 {
+		log.Info().Int64("deleted", deleted).Msg("Pruned message store")
+	}
+}
+
+// PruneLoop prunes the message store now and then once a day
+func (ms *MessageStore) PruneLoop() {
+	for {
+		ms.Prune()
+		time.Sleep(24 * time.Hour)
+	}
+}
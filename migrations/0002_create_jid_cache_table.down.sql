@@ -0,0 +1,2 @@
+-- migrations/0002_create_jid_cache_table.down.sql
+DROP TABLE jid_cache;
@@ -0,0 +1,12 @@
+-- migrations/0002_create_jid_cache_table.up.sql
+CREATE TABLE IF NOT EXISTS jid_cache (
+    query TEXT PRIMARY KEY,
+    jid TEXT NOT NULL DEFAULT '',
+    lid TEXT NOT NULL DEFAULT '',
+    is_in BOOLEAN NOT NULL DEFAULT FALSE,
+    verified_name TEXT NOT NULL DEFAULT '',
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS jid_cache_jid_idx ON jid_cache (jid);
+CREATE INDEX IF NOT EXISTS jid_cache_lid_idx ON jid_cache (lid);
@@ -0,0 +1,2 @@
+-- migrations/0003_create_messages_table.down.sql
+DROP TABLE messages;
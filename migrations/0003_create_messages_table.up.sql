@@ -0,0 +1,17 @@
+-- migrations/0003_create_messages_table.up.sql
+CREATE TABLE IF NOT EXISTS messages (
+    user_id INTEGER NOT NULL,
+    chat TEXT NOT NULL,
+    id TEXT NOT NULL,
+    sender TEXT NOT NULL DEFAULT '',
+    from_me BOOLEAN NOT NULL DEFAULT FALSE,
+    type TEXT NOT NULL DEFAULT '',
+    push_name TEXT NOT NULL DEFAULT '',
+    timestamp TIMESTAMP NOT NULL,
+    message BYTEA,
+    viewed_at TIMESTAMP,
+    PRIMARY KEY (user_id, chat, id)
+);
+
+CREATE INDEX IF NOT EXISTS messages_user_chat_timestamp_idx ON messages (user_id, chat, timestamp);
+CREATE INDEX IF NOT EXISTS messages_timestamp_idx ON messages (timestamp);
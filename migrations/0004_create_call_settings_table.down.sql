@@ -0,0 +1,2 @@
+-- migrations/0004_create_call_settings_table.down.sql
+DROP TABLE call_settings;
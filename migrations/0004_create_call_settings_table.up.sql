@@ -0,0 +1,7 @@
+-- migrations/0004_create_call_settings_table.up.sql
+CREATE TABLE IF NOT EXISTS call_settings (
+    user_id INTEGER PRIMARY KEY,
+    auto_reject BOOLEAN NOT NULL DEFAULT FALSE,
+    reject_message TEXT NOT NULL DEFAULT '',
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,2 @@
+-- migrations/0005_add_webhook_format.down.sql
+ALTER TABLE users DROP COLUMN webhook_format;
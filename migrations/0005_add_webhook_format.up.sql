@@ -0,0 +1,2 @@
+-- migrations/0005_add_webhook_format.up.sql
+ALTER TABLE users ADD COLUMN IF NOT EXISTS webhook_format TEXT NOT NULL DEFAULT 'v1-raw';
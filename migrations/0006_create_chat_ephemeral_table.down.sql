@@ -0,0 +1,2 @@
+-- migrations/0006_create_chat_ephemeral_table.down.sql
+DROP TABLE chat_ephemeral;
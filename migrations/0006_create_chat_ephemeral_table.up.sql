@@ -0,0 +1,8 @@
+-- migrations/0006_create_chat_ephemeral_table.up.sql
+CREATE TABLE IF NOT EXISTS chat_ephemeral (
+    user_id INTEGER NOT NULL,
+    chat TEXT NOT NULL,
+    expiration INTEGER NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, chat)
+);
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// uploadedFile é o arquivo recebido numa requisição multipart/form-data.
+// Arquivos pequenos ficam em memória; os maiores que uploadMemoryBytes são
+// gravados num arquivo temporário enquanto o corpo é lido.
+type uploadedFile struct {
+	data        []byte
+	path        string
+	FileName    string
+	ContentType string
+}
+
+// Bytes retorna o conteúdo do arquivo. O upload para o WhatsApp precisa do
+// arquivo inteiro, então os arquivos temporários são lidos só neste momento.
+func (f *uploadedFile) Bytes() ([]byte, error) {
+	if f.path == "" {
+		return f.data, nil
+	}
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read uploaded file: %v", err)
+	}
+	return data, nil
+}
+
+// Remove apaga o arquivo temporário, se houver. Pode ser chamado com nil.
+func (f *uploadedFile) Remove() {
+	if f == nil || f.path == "" {
+		return
+	}
+	if err := os.Remove(f.path); err != nil {
+		log.Warn().Err(err).Str("path", f.path).Msg("Could not remove uploaded file")
+	}
+}
+
+// Partes de arquivo até este tamanho são mantidas em memória
+const uploadMemoryBytes = 10 << 20
+
+// Tamanho máximo aceito para uploads multipart (UPLOAD_MAX_BYTES, padrão 100MB).
+func uploadMaxBytes() int64 {
+	if v, err := strconv.ParseInt(os.Getenv("UPLOAD_MAX_BYTES"), 10, 64); err == nil && v > 0 {
+		return v
+	}
+	return 100 << 20
+}
+
+func isMultipartRequest(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "multipart/form-data"
+}
+
+// decodeMediaPayload decodifica o corpo da requisição em dst.
+//
+// Requisições JSON são decodificadas normalmente e o arquivo retornado é nil.
+// Em multipart/form-data os campos do formulário são mapeados para dst pelos
+// mesmos nomes aceitos no JSON (ex: "phone", "caption", "contextInfo") e a
+// parte que contém um arquivo é lida diretamente, sem passar por base64.
+// Quem recebe o arquivo deve chamar Remove ao terminar.
+func decodeMediaPayload(r *http.Request, dst interface{}) (upload *uploadedFile, err error) {
+	if !isMultipartRequest(r) {
+		if err := json.NewDecoder(r.Body).Decode(dst); err != nil {
+			return nil, errors.New("Could not decode Payload")
+		}
+		return nil, nil
+	}
+
+	maxBytes := uploadMaxBytes()
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, fmt.Errorf("Could not read multipart payload: %v", err)
+	}
+
+	// campos repetidos (ex: vários "emojis") guardam todos os valores, na ordem
+	values := make(map[string][]string)
+	var names []string
+	var file *uploadedFile
+	defer func() {
+		if err != nil {
+			file.Remove()
+		}
+	}()
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Could not read multipart payload: %v", err)
+		}
+
+		if part.FileName() != "" {
+			if file != nil {
+				part.Close()
+				return nil, errors.New("Only one file can be sent per request")
+			}
+			file = &uploadedFile{
+				FileName:    part.FileName(),
+				ContentType: part.Header.Get("Content-Type"),
+			}
+			err := readUploadedFile(file, part, maxBytes)
+			part.Close()
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		name := part.FormName()
+		value, err := io.ReadAll(io.LimitReader(part, 1<<20))
+		part.Close()
+		if err != nil {
+			return nil, fmt.Errorf("Could not read field %s: %v", name, err)
+		}
+		if name != "" {
+			if _, ok := values[name]; !ok {
+				names = append(names, name)
+			}
+			values[name] = append(values[name], string(value))
+		}
+	}
+
+	fields := make(map[string]json.RawMessage)
+	for _, name := range names {
+		fieldType, ok := jsonFieldType(dst, name)
+		if !ok {
+			continue
+		}
+		encoded, err := formValuesToJSON(fieldType, values[name])
+		if err != nil {
+			return nil, fmt.Errorf("Could not decode field %s: %v", name, err)
+		}
+		fields[name] = encoded
+	}
+
+	raw, err := json.Marshal(fields)
+	if err != nil {
+		return nil, errors.New("Could not decode Payload")
+	}
+	if err := json.Unmarshal(raw, dst); err != nil {
+		return nil, fmt.Errorf("Could not decode Payload: %v", err)
+	}
+	return file, nil
+}
+
+// readUploadedFile lê a parte do arquivo em memória até uploadMemoryBytes e
+// grava o restante num arquivo temporário, sem manter o arquivo inteiro em
+// memória durante a leitura da requisição.
+func readUploadedFile(file *uploadedFile, part io.Reader, maxBytes int64) error {
+	limited := io.LimitReader(part, maxBytes+1)
+	head, err := io.ReadAll(io.LimitReader(limited, uploadMemoryBytes+1))
+	if err != nil {
+		return fmt.Errorf("Could not read uploaded file: %v", err)
+	}
+	if len(head) <= uploadMemoryBytes {
+		file.data = head
+		return nil
+	}
+
+	tmp, err := os.CreateTemp("", "wuzapi-upload-*")
+	if err != nil {
+		return fmt.Errorf("Could not store uploaded file: %v", err)
+	}
+	file.path = tmp.Name()
+	written, err := tmp.Write(head)
+	if err == nil {
+		var rest int64
+		rest, err = io.Copy(tmp, limited)
+		written += int(rest)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("Could not store uploaded file: %v", err)
+	}
+	if int64(written) > maxBytes {
+		return fmt.Errorf("Uploaded file exceeds the limit of %d bytes", maxBytes)
+	}
+	return nil
+}
+
+// jsonFieldType retorna o tipo do campo de dst que o encoding/json usaria
+// para a chave name: pelo nome da tag json ou do campo, sem diferenciar
+// maiúsculas de minúsculas.
+func jsonFieldType(dst interface{}, name string) (reflect.Type, bool) {
+	t := reflect.TypeOf(dst)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, false
+	}
+	var folded reflect.Type
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		key := field.Name
+		if tag := field.Tag.Get("json"); tag != "" {
+			if tag == "-" {
+				continue
+			}
+			if tagName := strings.Split(tag, ",")[0]; tagName != "" {
+				key = tagName
+			}
+		}
+		if key == name {
+			return field.Type, true
+		}
+		if folded == nil && strings.EqualFold(key, name) {
+			folded = field.Type
+		}
+	}
+	return folded, folded != nil
+}
+
+// formValuesToJSON converte os valores de um campo de formulário para o JSON
+// esperado pelo tipo do campo de destino. Campos que não são listas usam o
+// último valor enviado.
+func formValuesToJSON(t reflect.Type, values []string) (json.RawMessage, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8 {
+		// uma lista pode vir como um único campo com o array em JSON
+		if len(values) == 1 {
+			if trimmed := strings.TrimSpace(values[0]); strings.HasPrefix(trimmed, "[") && json.Valid([]byte(trimmed)) {
+				return json.RawMessage(trimmed), nil
+			}
+		}
+		items := make([]json.RawMessage, 0, len(values))
+		for _, value := range values {
+			item, err := formValueToJSON(t.Elem(), value)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return json.Marshal(items)
+	}
+	return formValueToJSON(t, values[len(values)-1])
+}
+
+// formValueToJSON converte um valor de formulário para o JSON do tipo t:
+// booleanos e números são validados, structs e mapas (como contextInfo)
+// devem vir em JSON e todo o resto vira string.
+func formValueToJSON(t reflect.Type, value string) (json.RawMessage, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	trimmed := strings.TrimSpace(value)
+	switch t.Kind() {
+	case reflect.Bool:
+		b, err := strconv.ParseBool(trimmed)
+		if err != nil {
+			return nil, errors.New("must be true or false")
+		}
+		return json.Marshal(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		if _, err := strconv.ParseFloat(trimmed, 64); err != nil {
+			return nil, errors.New("must be a number")
+		}
+		return json.RawMessage(trimmed), nil
+	case reflect.Struct, reflect.Map, reflect.Slice:
+		// []byte é codificado em base64 pelo encoding/json, como no JSON
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			return json.Marshal(trimmed)
+		}
+		if !json.Valid([]byte(trimmed)) {
+			return nil, errors.New("must be valid JSON")
+		}
+		return json.RawMessage(trimmed), nil
+	}
+	return json.Marshal(value)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+// quotedMessage returns the content of the message being replied to, read
+// from the message store. Clients render the quote from this content, so a
+// message that was never stored is quoted as an empty text.
+func (s *server) quotedMessage(userID int, chat types.JID, stanzaID string) *waProto.Message {
+	stored, err := s.messages.Get(userID, chat, stanzaID)
+	if err != nil {
+		log.Warn().Err(err).Str("id", stanzaID).Msg("Quoted message not found in message store, quoting empty text")
+		return &waProto.Message{Conversation: proto.String("")}
+	}
+	msg, err := stored.Decode()
+	if err != nil {
+		log.Warn().Err(err).Str("id", stanzaID).Msg("Could not decode quoted message, quoting empty text")
+		return &waProto.Message{Conversation: proto.String("")}
+	}
+
+	inner, wrappers := unwrapMessage(msg)
+	if wrappers.ViewOnce || inner.GetImageMessage().GetViewOnce() || inner.GetVideoMessage().GetViewOnce() || inner.GetAudioMessage().GetViewOnce() {
+		return viewOncePlaceholder(inner)
+	}
+	quoted := proto.Clone(inner).(*waProto.Message)
+	// the quote of the quoted message is not sent along
+	if contextInfo := messageContextInfo(quoted); contextInfo != nil {
+		contextInfo.StanzaID = nil
+		contextInfo.Participant = nil
+		contextInfo.QuotedMessage = nil
+	}
+	return quoted
+}
+
+// viewOncePlaceholder quotes a view once message by its type only. The media
+// key and file references are left out so the reply does not carry a copy
+// of the media that can be opened again.
+func viewOncePlaceholder(msg *waProto.Message) *waProto.Message {
+	switch {
+	case msg.ImageMessage != nil:
+		return &waProto.Message{ImageMessage: &waProto.ImageMessage{Mimetype: msg.ImageMessage.Mimetype, ViewOnce: proto.Bool(true)}}
+	case msg.VideoMessage != nil:
+		return &waProto.Message{VideoMessage: &waProto.VideoMessage{Mimetype: msg.VideoMessage.Mimetype, ViewOnce: proto.Bool(true)}}
+	case msg.AudioMessage != nil:
+		return &waProto.Message{AudioMessage: &waProto.AudioMessage{Mimetype: msg.AudioMessage.Mimetype, PTT: msg.AudioMessage.PTT, ViewOnce: proto.Bool(true)}}
+	}
+	return &waProto.Message{Conversation: proto.String("")}
+}
+
+// applyContextInfo sets the reply, mentions and expiration requested by the
+// caller on the ContextInfo of the message actually being sent, instead of
+// always on an ExtendedTextMessage. Without an expiration the message takes
+// the current disappearing timer of the chat.
+func (s *server) applyContextInfo(userID int, chat types.JID, msg *waProto.Message, requested *waProto.ContextInfo) {
+	expiration := requested.GetExpiration()
+	if requested.Expiration == nil {
+		expiration = s.chatExpiration(clientPointer[userID], userID, chat)
+	}
+	if requested.StanzaID == nil && requested.MentionedJID == nil && expiration == 0 {
+		return
+	}
+	contextInfo := contextInfoFor(msg)
+	if contextInfo == nil {
+		return
+	}
+
+	if requested.StanzaID != nil {
+		contextInfo.StanzaID = proto.String(*requested.StanzaID)
+		if requested.Participant != nil {
+			contextInfo.Participant = proto.String(*requested.Participant)
+		}
+		if requested.QuotedMessage != nil {
+			contextInfo.QuotedMessage = requested.QuotedMessage
+		} else {
+			contextInfo.QuotedMessage = s.quotedMessage(userID, chat, *requested.StanzaID)
+		}
+	}
+	if requested.MentionedJID != nil {
+		contextInfo.MentionedJID = requested.MentionedJID
+	}
+	if expiration > 0 {
+		contextInfo.Expiration = proto.Uint32(expiration)
+	}
+}
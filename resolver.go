@@ -0,0 +1,270 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Old group ids, "<creator phone>-<timestamp>"
+var legacyGroupID = regexp.MustCompile(`^[0-9]+-[0-9]+$`)
+
+// ErrNotOnWhatsApp is returned when a phone number has no WhatsApp account
+var ErrNotOnWhatsApp = errors.New("Phone is not on WhatsApp")
+
+// ResolvedJID is the canonical address of a phone, group or LID
+type ResolvedJID struct {
+	Query        string
+	JID          types.JID
+	LID          types.JID
+	IsIn         bool
+	VerifiedName string
+	Cached       bool
+}
+
+// JIDResolver turns user input (phone numbers, JIDs, LIDs, group ids) into
+// the canonical JID, checking phone numbers with IsOnWhatsApp once and
+// caching the answer in the jid_cache table.
+type JIDResolver struct {
+	db          *sqlx.DB
+	TTL         time.Duration
+	NegativeTTL time.Duration
+}
+
+// NewJIDResolver reads JID_CACHE_TTL (default 24h) and
+// JID_CACHE_NEGATIVE_TTL (default 1h, for numbers not on WhatsApp)
+func NewJIDResolver(db *sqlx.DB) *JIDResolver {
+	resolver := &JIDResolver{db: db, TTL: 24 * time.Hour, NegativeTTL: time.Hour}
+	if v, err := time.ParseDuration(os.Getenv("JID_CACHE_TTL")); err == nil && v > 0 {
+		resolver.TTL = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("JID_CACHE_NEGATIVE_TTL")); err == nil && v > 0 {
+		resolver.NegativeTTL = v
+	}
+	return resolver
+}
+
+type jidCacheRow struct {
+	Query        string    `db:"query"`
+	JID          string    `db:"jid"`
+	LID          string    `db:"lid"`
+	IsIn         bool      `db:"is_in"`
+	VerifiedName string    `db:"verified_name"`
+	UpdatedAt    time.Time `db:"updated_at"`
+}
+
+func (row *jidCacheRow) resolved() *ResolvedJID {
+	result := &ResolvedJID{Query: row.Query, IsIn: row.IsIn, VerifiedName: row.VerifiedName, Cached: true}
+	result.JID, _ = types.ParseJID(row.JID)
+	result.LID, _ = types.ParseJID(row.LID)
+	return result
+}
+
+// phoneCandidates lists the numbers to be checked for a phone. Brazilian
+// mobile numbers may be registered with or without the 9th digit.
+func phoneCandidates(phone string) []string {
+	candidates := []string{phone}
+	if strings.HasPrefix(phone, "55") {
+		switch len(phone) {
+		case 13:
+			if phone[4] == '9' {
+				candidates = append(candidates, phone[:4]+phone[5:])
+			}
+		case 12:
+			if phone[4] >= '6' {
+				candidates = append(candidates, phone[:4]+"9"+phone[4:])
+			}
+		}
+	}
+	return candidates
+}
+
+// Resolve returns the canonical JID for the input
+func (jr *JIDResolver) Resolve(cli *whatsmeow.Client, input string) (*ResolvedJID, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return nil, errors.New("Missing Phone")
+	}
+
+	if strings.ContainsRune(input, '@') {
+		jid, err := types.ParseJID(strings.TrimPrefix(input, "+"))
+		if err != nil || jid.User == "" {
+			return nil, errors.New("Could not parse Phone")
+		}
+		switch jid.Server {
+		case types.DefaultUserServer, types.LegacyUserServer:
+			return jr.resolvePhone(cli, jid.User)
+		case types.HiddenUserServer:
+			return jr.resolveLID(jid), nil
+		default:
+			// groups, newsletters and broadcast lists are used as they are
+			return &ResolvedJID{Query: input, JID: jid, IsIn: true}, nil
+		}
+	}
+
+	phone := onlyDigits(input)
+	if phone == "" {
+		return nil, errors.New("Could not parse Phone")
+	}
+	// group ids sent without the @g.us suffix
+	if legacyGroupID.MatchString(input) || phone == input && len(phone) >= 18 && strings.HasPrefix(phone, "120363") {
+		return &ResolvedJID{Query: input, JID: types.NewJID(input, types.GroupServer), IsIn: true}, nil
+	}
+	return jr.resolvePhone(cli, phone)
+}
+
+// Cached resolves the input from the jid cache only, without checking the
+// phone on WhatsApp. Used for filters, where an unknown number is kept as is.
+func (jr *JIDResolver) Cached(input string) (*ResolvedJID, error) {
+	input = strings.TrimSpace(input)
+	phone := onlyDigits(input)
+	if strings.ContainsRune(input, '@') {
+		jid, err := types.ParseJID(strings.TrimPrefix(input, "+"))
+		if err != nil || jid.User == "" {
+			return nil, errors.New("Could not parse Phone")
+		}
+		switch jid.Server {
+		case types.HiddenUserServer:
+			return jr.resolveLID(jid), nil
+		case types.DefaultUserServer, types.LegacyUserServer:
+			phone = jid.User
+		default:
+			return &ResolvedJID{Query: input, JID: jid, IsIn: true}, nil
+		}
+	}
+	if phone == "" {
+		return nil, errors.New("Could not parse Phone")
+	}
+
+	result := &ResolvedJID{Query: phone, JID: types.NewJID(phone, types.DefaultUserServer)}
+	var row jidCacheRow
+	err := jr.db.Get(&row, "SELECT * FROM jid_cache WHERE query=$1", phone)
+	if err == nil {
+		result = row.resolved()
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		log.Warn().Err(err).Msg("Could not read jid cache")
+	}
+	return result, nil
+}
+
+func (jr *JIDResolver) resolveLID(lid types.JID) *ResolvedJID {
+	result := &ResolvedJID{Query: lid.String(), JID: lid, LID: lid, IsIn: true}
+	var row jidCacheRow
+	err := jr.db.Get(&row, "SELECT * FROM jid_cache WHERE lid=$1 AND is_in LIMIT 1", lid.ToNonAD().String())
+	if err == nil {
+		if pn, err := types.ParseJID(row.JID); err == nil {
+			result.JID = pn
+			result.Cached = true
+		}
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		log.Warn().Err(err).Msg("Could not read jid cache")
+	}
+	return result
+}
+
+func (jr *JIDResolver) resolvePhone(cli *whatsmeow.Client, phone string) (*ResolvedJID, error) {
+	var row jidCacheRow
+	err := jr.db.Get(&row, "SELECT * FROM jid_cache WHERE query=$1", phone)
+	if err == nil {
+		ttl := jr.TTL
+		if !row.IsIn {
+			ttl = jr.NegativeTTL
+		}
+		if time.Since(row.UpdatedAt) < ttl {
+			if !row.IsIn {
+				return row.resolved(), ErrNotOnWhatsApp
+			}
+			return row.resolved(), nil
+		}
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		log.Warn().Err(err).Msg("Could not read jid cache")
+	}
+
+	candidates := phoneCandidates(phone)
+	queries := make([]string, len(candidates))
+	for i, candidate := range candidates {
+		queries[i] = "+" + candidate
+	}
+	resp, err := cli.IsOnWhatsApp(queries)
+	if err != nil {
+		return nil, fmt.Errorf("Could not check phone on WhatsApp: %v", err)
+	}
+
+	result := &ResolvedJID{Query: phone}
+	for _, candidate := range candidates {
+		for _, status := range resp {
+			if strings.TrimPrefix(status.Query, "+") == candidate && status.IsIn {
+				result.JID = status.JID
+				result.IsIn = true
+				if status.VerifiedName != nil && status.VerifiedName.Details != nil {
+					result.VerifiedName = status.VerifiedName.Details.GetVerifiedName()
+				}
+				break
+			}
+		}
+		if result.IsIn {
+			break
+		}
+	}
+	if !result.IsIn {
+		result.JID = types.NewJID(phone, types.DefaultUserServer)
+	}
+	if row.LID != "" {
+		result.LID, _ = types.ParseJID(row.LID)
+	}
+
+	_, err = jr.db.Exec(`INSERT INTO jid_cache (query, jid, is_in, verified_name, updated_at) VALUES ($1, $2, $3, $4, NOW())
+		ON CONFLICT (query) DO UPDATE SET jid=EXCLUDED.jid, is_in=EXCLUDED.is_in, verified_name=EXCLUDED.verified_name, updated_at=NOW()`,
+		phone, result.JID.String(), result.IsIn, result.VerifiedName)
+	if err != nil {
+		log.Warn().Err(err).Msg("Could not write jid cache")
+	}
+
+	if !result.IsIn {
+		return result, ErrNotOnWhatsApp
+	}
+	return result, nil
+}
+
+// RememberLID stores the LID of a phone number, learned from group participants
+func (jr *JIDResolver) RememberLID(pn, lid types.JID) {
+	if pn.Server != types.DefaultUserServer || lid.Server != types.HiddenUserServer || lid.User == "" {
+		return
+	}
+	_, err := jr.db.Exec(`INSERT INTO jid_cache (query, jid, lid, is_in, updated_at) VALUES ($1, $2, $3, TRUE, NOW())
+		ON CONFLICT (query) DO UPDATE SET lid=EXCLUDED.lid`,
+		pn.User, pn.ToNonAD().String(), lid.ToNonAD().String())
+	if err != nil {
+		log.Warn().Err(err).Msg("Could not write jid cache")
+	}
+}
+
+// LIDFor returns the LID of a phone number, or an empty JID when it is not
+// known yet. LIDs are learned from the participants of groups.
+func (jr *JIDResolver) LIDFor(pn types.JID) types.JID {
+	var lid string
+	err := jr.db.Get(&lid, "SELECT lid FROM jid_cache WHERE query=$1", pn.User)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Warn().Err(err).Msg("Could not read jid cache")
+		}
+		return types.EmptyJID
+	}
+	parsed, _ := types.ParseJID(lid)
+	return parsed
+}
+
+// RememberParticipants stores the LID mapping of group participants
+func (jr *JIDResolver) RememberParticipants(participants []types.GroupParticipant) {
+	for _, participant := range participants {
+		jr.RememberLID(participant.JID, participant.LID)
+	}
+}
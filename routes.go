@@ -9,6 +9,7 @@ import (
 	"github.com/justinas/alice"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/hlog"
+	"go.mau.fi/whatsmeow/types/events"
 )
 
 type Middleware = alice.Constructor
@@ -64,6 +65,7 @@ func (s *server) routes() {
 	s.router.Handle("/webhook", c.Then(s.GetWebhook())).Methods("GET")
 	s.router.Handle("/webhook", c.Then(s.DeleteWebhook())).Methods("DELETE")     // Nova rota
 	s.router.Handle("/webhook/update", c.Then(s.UpdateWebhook())).Methods("PUT") // Nova rota
+	s.router.Handle("/webhook/schema", c.Then(s.GetWebhookSchema())).Methods("GET")
 
 	s.router.Handle("/chat/send/media", c.Then(s.SendMedia())).Methods("POST")
 	s.router.Handle("/chat/send/text", c.Then(s.SendMessage())).Methods("POST")
@@ -76,14 +78,30 @@ func (s *server) routes() {
 	s.router.Handle("/chat/send/location", c.Then(s.SendLocation())).Methods("POST")
 	s.router.Handle("/chat/send/contact", c.Then(s.SendContact())).Methods("POST")
 	s.router.Handle("/chat/react", c.Then(s.React())).Methods("POST")
+	s.router.Handle("/chat/forward", c.Then(s.ForwardMessage())).Methods("POST")
+	s.router.Handle("/chat/disappearing", c.Then(s.SetDisappearingTimer())).Methods("POST")
 	s.router.Handle("/chat/send/buttons", c.Then(s.SendButtons())).Methods("POST")
 	s.router.Handle("/chat/send/list", c.Then(s.SendList())).Methods("POST")
+	s.router.Handle("/chat/send/interactive", c.Then(s.SendInteractive())).Methods("POST")
 
 	s.router.Handle("/user/info", c.Then(s.GetUser())).Methods("POST")
 	s.router.Handle("/user/check", c.Then(s.CheckUser())).Methods("POST")
 	s.router.Handle("/user/avatar", c.Then(s.GetAvatar())).Methods("POST")
 	s.router.Handle("/user/contacts", c.Then(s.GetContacts())).Methods("GET")
+	s.router.Handle("/user/contacts", c.Then(s.SaveContact())).Methods("POST")
 	s.router.Handle("/user/onwhatsapp", c.Then(s.IsOnWhatsApp())).Methods("POST")
+	s.router.Handle("/user/resolve", c.Then(s.ResolveJID())).Methods("GET")
+	s.router.Handle("/user/profile", c.Then(s.GetProfile())).Methods("GET")
+	s.router.Handle("/user/profile/name", c.Then(s.SetProfileName())).Methods("POST")
+	s.router.Handle("/user/profile/about", c.Then(s.SetProfileAbout())).Methods("POST")
+	s.router.Handle("/user/profile/photo", c.Then(s.SetProfilePhoto())).Methods("POST")
+	s.router.Handle("/user/privacy", c.Then(s.GetPrivacySettings())).Methods("GET")
+	s.router.Handle("/user/privacy", c.Then(s.SetPrivacySettings())).Methods("POST")
+	s.router.Handle("/user/blocklist", c.Then(s.GetBlocklist())).Methods("GET")
+	s.router.Handle("/user/block", c.Then(s.UpdateBlocklist(events.BlocklistChangeActionBlock))).Methods("POST")
+	s.router.Handle("/user/unblock", c.Then(s.UpdateBlocklist(events.BlocklistChangeActionUnblock))).Methods("POST")
+	s.router.Handle("/user/enrich", c.Then(s.StartEnrichment())).Methods("POST")
+	s.router.Handle("/user/enrich/{id}", c.Then(s.GetEnrichment())).Methods("GET")
 
 	s.router.Handle("/chat/presence", c.Then(s.ChatPresence())).Methods("POST")
 	s.router.Handle("/chat/markread", c.Then(s.MarkRead())).Methods("POST")
@@ -93,6 +111,47 @@ func (s *server) routes() {
 	s.router.Handle("/group/invitelink", c.Then(s.GetGroupInviteLink())).Methods("GET")
 	s.router.Handle("/group/photo", c.Then(s.SetGroupPhoto())).Methods("POST")
 	s.router.Handle("/group/name", c.Then(s.SetGroupName())).Methods("POST")
+	s.router.Handle("/group/create", c.Then(s.CreateGroup())).Methods("POST")
+	s.router.Handle("/group/participants", c.Then(s.UpdateGroupParticipants())).Methods("POST")
+	s.router.Handle("/group/topic", c.Then(s.SetGroupTopic())).Methods("POST")
+	s.router.Handle("/group/leave", c.Then(s.LeaveGroup())).Methods("POST")
+	s.router.Handle("/group/announce", c.Then(s.SetGroupAnnounce())).Methods("POST")
+	s.router.Handle("/group/locked", c.Then(s.SetGroupLocked())).Methods("POST")
+	s.router.Handle("/group/disappearing", c.Then(s.SetGroupDisappearing())).Methods("POST")
+	s.router.Handle("/group/invitelink/revoke", c.Then(s.RevokeGroupInviteLink())).Methods("POST")
+	s.router.Handle("/group/join", c.Then(s.JoinGroup())).Methods("POST")
+	s.router.Handle("/group/inviteinfo", c.Then(s.GetGroupInviteInfo())).Methods("GET")
+	s.router.Handle("/group/approvalmode", c.Then(s.SetGroupApprovalMode())).Methods("POST")
+	s.router.Handle("/group/requests", c.Then(s.ListGroupRequests())).Methods("GET")
+	s.router.Handle("/group/requests", c.Then(s.UpdateGroupRequests())).Methods("POST")
+
+	s.router.Handle("/community/create", c.Then(s.CreateCommunity())).Methods("POST")
+	s.router.Handle("/community/link", c.Then(s.UpdateCommunityGroup(true))).Methods("POST")
+	s.router.Handle("/community/unlink", c.Then(s.UpdateCommunityGroup(false))).Methods("POST")
+	s.router.Handle("/community/subgroups", c.Then(s.ListCommunitySubGroups())).Methods("GET")
+	s.router.Handle("/community/participants", c.Then(s.ListCommunityParticipants())).Methods("GET")
+
+	s.router.Handle("/status/send/text", c.Then(s.SendStatus("text"))).Methods("POST")
+	s.router.Handle("/status/send/image", c.Then(s.SendStatus("image"))).Methods("POST")
+	s.router.Handle("/status/send/video", c.Then(s.SendStatus("video"))).Methods("POST")
+	s.router.Handle("/status/privacy", c.Then(s.GetStatusPrivacy())).Methods("GET")
+	s.router.Handle("/status/recent", c.Then(s.GetRecentStatuses())).Methods("GET")
+	s.router.Handle("/status/view", c.Then(s.ViewStatus())).Methods("POST")
+
+	s.router.Handle("/newsletter/create", c.Then(s.CreateNewsletter())).Methods("POST")
+	s.router.Handle("/newsletter/info", c.Then(s.GetNewsletterInfo())).Methods("GET")
+	s.router.Handle("/newsletter/list", c.Then(s.ListNewsletters())).Methods("GET")
+	s.router.Handle("/newsletter/follow", c.Then(s.UpdateNewsletterFollow(true))).Methods("POST")
+	s.router.Handle("/newsletter/unfollow", c.Then(s.UpdateNewsletterFollow(false))).Methods("POST")
+	s.router.Handle("/newsletter/send/text", c.Then(s.SendNewsletterMessage("text"))).Methods("POST")
+	s.router.Handle("/newsletter/send/image", c.Then(s.SendNewsletterMessage("image"))).Methods("POST")
+	s.router.Handle("/newsletter/send/video", c.Then(s.SendNewsletterMessage("video"))).Methods("POST")
+	s.router.Handle("/newsletter/messages", c.Then(s.GetNewsletterMessages())).Methods("GET")
+	s.router.Handle("/newsletter/live", c.Then(s.SubscribeNewsletterLive())).Methods("POST")
+
+	s.router.Handle("/call/reject", c.Then(s.RejectCall())).Methods("POST")
+	s.router.Handle("/call/settings", c.Then(s.GetCallSettings())).Methods("GET")
+	s.router.Handle("/call/settings", c.Then(s.SetCallSettings())).Methods("POST")
 
 	s.router.PathPrefix("/").Handler(http.FileServer(http.Dir(exPath + "/static/")))
 }
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/gif"
+)
+
+// Dimensão e tamanho máximo dos stickers aceitos pelo WhatsApp.
+const (
+	stickerSize            = 512
+	stickerMaxBytes        = 500 << 10
+	stickerMaxAnimDuration = "8"
+)
+
+// StickerMetadata são os dados do pacote gravados no EXIF do webp, da mesma
+// forma que os aplicativos criadores de stickers fazem.
+type StickerMetadata struct {
+	PackID    string   `json:"sticker-pack-id,omitempty"`
+	PackName  string   `json:"sticker-pack-name,omitempty"`
+	Publisher string   `json:"sticker-pack-publisher,omitempty"`
+	Emojis    []string `json:"emojis,omitempty"`
+}
+
+func (m *StickerMetadata) empty() bool {
+	return m == nil || (m.PackName == "" && m.Publisher == "" && len(m.Emojis) == 0)
+}
+
+// ToSticker converte imagens para webp 512x512 com preenchimento transparente.
+// GIFs animados e vídeos viram webp animado. Se meta for informado, os dados
+// do pacote são gravados no chunk EXIF.
+func (t *MediaTranscoder) ToSticker(ctx context.Context, data []byte, meta *StickerMetadata) (*TranscodeResult, error) {
+	container := sniffContainer(data)
+	result := &TranscodeResult{Data: data, MimeType: "image/webp"}
+
+	switch {
+	case container == "webp":
+		width, height, animated, err := webpInfo(data)
+		if err != nil {
+			return nil, err
+		}
+		// ffmpeg não decodifica webp animado: mantém o original
+		if animated || (width == stickerSize && height == stickerSize) {
+			result.Width, result.Height, result.Animated = width, height, animated
+			break
+		}
+		if err := t.encodeStaticSticker(ctx, result); err != nil {
+			return nil, err
+		}
+
+	case container == "gif" && isAnimatedGIF(data),
+		container == "mp4", container == "mov", container == "webm", container == "matroska":
+		if err := t.encodeAnimatedSticker(ctx, result); err != nil {
+			return nil, err
+		}
+
+	default:
+		if err := t.encodeStaticSticker(ctx, result); err != nil {
+			return nil, err
+		}
+	}
+
+	if !meta.empty() {
+		withExif, err := setWebpExif(result.Data, stickerExif(meta))
+		if err != nil {
+			return nil, fmt.Errorf("falha ao gravar metadados do sticker: %v", err)
+		}
+		result.Data = withExif
+	}
+	return result, nil
+}
+
+func stickerPadFilter() string {
+	return fmt.Sprintf("scale=%[1]d:%[1]d:force_original_aspect_ratio=decrease,format=rgba,"+
+		"pad=%[1]d:%[1]d:(ow-iw)/2:(oh-ih)/2:color=0x00000000", stickerSize)
+}
+
+func (t *MediaTranscoder) encodeStaticSticker(ctx context.Context, result *TranscodeResult) error {
+	out, err := t.run(ctx, result.Data, "webp",
+		"-vf", stickerPadFilter(),
+		"-frames:v", "1", "-c:v", "libwebp", "-lossless", "0", "-q:v", "80", "-f", "webp")
+	if err != nil {
+		return err
+	}
+	result.Data = out
+	result.Width, result.Height = stickerSize, stickerSize
+	result.Converted = true
+	return nil
+}
+
+// encodeAnimatedSticker reduz a qualidade até o arquivo caber no limite de
+// tamanho dos stickers animados.
+func (t *MediaTranscoder) encodeAnimatedSticker(ctx context.Context, result *TranscodeResult) error {
+	var out []byte
+	var err error
+	for _, quality := range []string{"60", "40", "20"} {
+		out, err = t.run(ctx, result.Data, "webp",
+			"-t", stickerMaxAnimDuration, "-an",
+			"-vf", "fps=15,"+stickerPadFilter(),
+			"-c:v", "libwebp", "-lossless", "0", "-q:v", quality,
+			"-loop", "0", "-preset", "picture", "-fps_mode", "passthrough", "-f", "webp")
+		if err != nil {
+			return err
+		}
+		if len(out) <= stickerMaxBytes {
+			break
+		}
+	}
+	result.Data = out
+	result.Width, result.Height = stickerSize, stickerSize
+	result.Animated = true
+	result.Converted = true
+	return nil
+}
+
+func isAnimatedGIF(data []byte) bool {
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	return err == nil && len(g.Image) > 1
+}
+
+// stickerExif monta o bloco EXIF (TIFF little-endian com a tag 0x5741) que
+// o WhatsApp lê para exibir o nome do pacote, o autor e os emojis.
+func stickerExif(meta *StickerMetadata) []byte {
+	if meta.PackID == "" {
+		meta.PackID = "wuzapi." + generateStickerPackID()
+	}
+	payload, _ := json.Marshal(meta)
+
+	exif := []byte{
+		0x49, 0x49, 0x2A, 0x00, 0x08, 0x00, 0x00, 0x00,
+		0x01, 0x00, 0x41, 0x57, 0x07, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x16, 0x00, 0x00, 0x00,
+	}
+	binary.LittleEndian.PutUint32(exif[14:18], uint32(len(payload)))
+	return append(exif, payload...)
+}
+
+// generateStickerPackID gera um identificador aleatório para o pacote.
+func generateStickerPackID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+type webpChunk struct {
+	fourCC string
+	data   []byte
+}
+
+func parseWebpChunks(data []byte) ([]webpChunk, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, errors.New("arquivo não é um webp válido")
+	}
+	var chunks []webpChunk
+	pos := 12
+	for pos+8 <= len(data) {
+		fourCC := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		start := pos + 8
+		if size < 0 || start+size > len(data) {
+			return nil, errors.New("webp com chunk truncado")
+		}
+		chunks = append(chunks, webpChunk{fourCC: fourCC, data: data[start : start+size]})
+		pos = start + size + size%2
+	}
+	if len(chunks) == 0 {
+		return nil, errors.New("webp sem conteúdo")
+	}
+	return chunks, nil
+}
+
+// webpInfo retorna as dimensões do webp e se ele é animado.
+func webpInfo(data []byte) (int, int, bool, error) {
+	chunks, err := parseWebpChunks(data)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	first := chunks[0]
+	switch first.fourCC {
+	case "VP8X":
+		if len(first.data) < 10 {
+			return 0, 0, false, errors.New("chunk VP8X inválido")
+		}
+		width := int(uint32(first.data[4])|uint32(first.data[5])<<8|uint32(first.data[6])<<16) + 1
+		height := int(uint32(first.data[7])|uint32(first.data[8])<<8|uint32(first.data[9])<<16) + 1
+		return width, height, first.data[0]&0x02 != 0, nil
+	case "VP8L":
+		if len(first.data) < 5 {
+			return 0, 0, false, errors.New("chunk VP8L inválido")
+		}
+		bits := binary.LittleEndian.Uint32(first.data[1:5])
+		return int(bits&0x3FFF) + 1, int((bits>>14)&0x3FFF) + 1, false, nil
+	case "VP8 ":
+		if len(first.data) < 10 {
+			return 0, 0, false, errors.New("chunk VP8 inválido")
+		}
+		width := int(binary.LittleEndian.Uint16(first.data[6:8]) & 0x3FFF)
+		height := int(binary.LittleEndian.Uint16(first.data[8:10]) & 0x3FFF)
+		return width, height, false, nil
+	}
+	return 0, 0, false, fmt.Errorf("chunk webp inesperado: %q", first.fourCC)
+}
+
+// setWebpExif grava (ou substitui) o chunk EXIF. Arquivos no formato simples
+// (apenas VP8/VP8L) ganham o cabeçalho estendido VP8X exigido pelo EXIF.
+func setWebpExif(data []byte, exif []byte) ([]byte, error) {
+	chunks, err := parseWebpChunks(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if chunks[0].fourCC != "VP8X" {
+		width, height, _, err := webpInfo(data)
+		if err != nil {
+			return nil, err
+		}
+		var flags byte
+		if chunks[0].fourCC == "VP8L" && len(chunks[0].data) >= 5 && chunks[0].data[4]&0x10 != 0 {
+			flags |= 0x10 // alpha
+		}
+		vp8x := make([]byte, 10)
+		vp8x[0] = flags
+		w, h := uint32(width-1), uint32(height-1)
+		vp8x[4], vp8x[5], vp8x[6] = byte(w), byte(w>>8), byte(w>>16)
+		vp8x[7], vp8x[8], vp8x[9] = byte(h), byte(h>>8), byte(h>>16)
+		chunks = append([]webpChunk{{fourCC: "VP8X", data: vp8x}}, chunks...)
+	}
+
+	vp8x := append([]byte(nil), chunks[0].data...)
+	vp8x[0] |= 0x08 // EXIF presente
+	chunks[0].data = vp8x
+
+	var body bytes.Buffer
+	body.WriteString("WEBP")
+	for _, chunk := range chunks {
+		if chunk.fourCC == "EXIF" {
+			continue
+		}
+		writeWebpChunk(&body, chunk.fourCC, chunk.data)
+	}
+	writeWebpChunk(&body, "EXIF", exif)
+
+	var out bytes.Buffer
+	out.WriteString("RIFF")
+	binary.Write(&out, binary.LittleEndian, uint32(body.Len()))
+	out.Write(body.Bytes())
+	return out.Bytes(), nil
+}
+
+func writeWebpChunk(buf *bytes.Buffer, fourCC string, data []byte) {
+	buf.WriteString(fourCC)
+	binary.Write(buf, binary.LittleEndian, uint32(len(data)))
+	buf.Write(data)
+	if len(data)%2 == 1 {
+		buf.WriteByte(0)
+	}
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrFFmpegNotFound é retornado quando o ffmpeg não está instalado ou não
+// foi encontrado no PATH (ou em FFMPEG_PATH).
+var ErrFFmpegNotFound = errors.New("ffmpeg não encontrado: instale o ffmpeg ou configure FFMPEG_PATH")
+
+// MediaInfo descreve o conteúdo detectado de um arquivo de mídia.
+type MediaInfo struct {
+	Container  string  // ogg, webm, mp4, mp3, wav, webp, gif, png, jpeg, ...
+	AudioCodec string  // opus, vorbis, aac, mp3, ...
+	VideoCodec string  // h264, vp8, vp9, hevc, ...
+	Duration   float64 // em segundos
+	Width      int
+	Height     int
+}
+
+// TranscodeResult é a mídia pronta para envio ao WhatsApp.
+type TranscodeResult struct {
+	Data      []byte
+	MimeType  string
+	Duration  float64
+	Width     int
+	Height    int
+	Waveform  []byte // apenas para mensagens de voz
+	Animated  bool   // apenas para stickers
+	Converted bool
+}
+
+// MediaTranscoder converte áudio, vídeo e stickers para os formatos aceitos
+// pelo WhatsApp. O container é detectado pelos bytes do arquivo e os codecs
+// pelo ffprobe; a conversão é feita com ffmpeg.
+type MediaTranscoder struct {
+	FFmpegPath  string
+	FFprobePath string
+	Timeout     time.Duration
+}
+
+// NewMediaTranscoder cria o transcoder usando FFMPEG_PATH, FFPROBE_PATH e
+// TRANSCODE_TIMEOUT (segundos, padrão 120).
+func NewMediaTranscoder() *MediaTranscoder {
+	t := &MediaTranscoder{
+		FFmpegPath:  "ffmpeg",
+		FFprobePath: "ffprobe",
+		Timeout:     120 * time.Second,
+	}
+	if v := os.Getenv("FFMPEG_PATH"); v != "" {
+		t.FFmpegPath = v
+	}
+	if v := os.Getenv("FFPROBE_PATH"); v != "" {
+		t.FFprobePath = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("TRANSCODE_TIMEOUT")); err == nil && v > 0 {
+		t.Timeout = time.Duration(v) * time.Second
+	}
+	return t
+}
+
+// sniffContainer identifica o formato do arquivo pelos primeiros bytes.
+func sniffContainer(data []byte) string {
+	switch {
+	case len(data) >= 4 && bytes.Equal(data[:4], []byte("OggS")):
+		return "ogg"
+	case len(data) >= 4 && bytes.Equal(data[:4], []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		if bytes.Contains(data[:min(len(data), 64)], []byte("webm")) {
+			return "webm"
+		}
+		return "matroska"
+	case len(data) >= 12 && bytes.Equal(data[4:8], []byte("ftyp")):
+		brand := string(data[8:12])
+		if brand == "qt  " {
+			return "mov"
+		}
+		if strings.HasPrefix(brand, "M4A") {
+			return "m4a"
+		}
+		return "mp4"
+	case len(data) >= 12 && bytes.Equal(data[:4], []byte("RIFF")) && bytes.Equal(data[8:12], []byte("WAVE")):
+		return "wav"
+	case len(data) >= 12 && bytes.Equal(data[:4], []byte("RIFF")) && bytes.Equal(data[8:12], []byte("WEBP")):
+		return "webp"
+	case len(data) >= 3 && bytes.Equal(data[:3], []byte("ID3")):
+		return "mp3"
+	case len(data) >= 4 && bytes.Equal(data[:4], []byte("fLaC")):
+		return "flac"
+	case len(data) >= 5 && bytes.Equal(data[:5], []byte("#!AMR")):
+		return "amr"
+	case len(data) >= 6 && (bytes.Equal(data[:6], []byte("GIF87a")) || bytes.Equal(data[:6], []byte("GIF89a"))):
+		return "gif"
+	case len(data) >= 8 && bytes.Equal(data[:8], []byte("\x89PNG\r\n\x1a\n")):
+		return "png"
+	case len(data) >= 3 && bytes.Equal(data[:3], []byte{0xFF, 0xD8, 0xFF}):
+		return "jpeg"
+	case len(data) >= 2 && data[0] == 0xFF && (data[1] == 0xF1 || data[1] == 0xF9):
+		return "aac"
+	case len(data) >= 2 && data[0] == 0xFF && data[1]&0xE0 == 0xE0:
+		return "mp3"
+	}
+	return ""
+}
+
+// Probe detecta container e codecs. Sem ffprobe disponível, retorna apenas
+// o que foi possível identificar pelos bytes.
+func (t *MediaTranscoder) Probe(ctx context.Context, data []byte) (*MediaInfo, error) {
+	info := &MediaInfo{Container: sniffContainer(data)}
+	if info.Container == "ogg" && len(data) >= 36 && bytes.Equal(data[28:36], []byte("OpusHead")) {
+		info.AudioCodec = "opus"
+	}
+
+	if _, err := exec.LookPath(t.FFprobePath); err != nil {
+		return info, nil
+	}
+
+	input, cleanup, err := writeTempMedia(data, "probe-*")
+	if err != nil {
+		return info, err
+	}
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(ctx, t.Timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, t.FFprobePath, "-v", "error",
+		"-show_entries", "format=format_name,duration:stream=codec_type,codec_name,width,height",
+		"-of", "json", input)
+	output, err := cmd.Output()
+	if err != nil {
+		if ctx.Err() != nil {
+			return info, fmt.Errorf("ffprobe interrompido: %w", ctx.Err())
+		}
+		// Arquivo que o ffprobe não reconhece: segue só com o sniff
+		return info, nil
+	}
+
+	var probe struct {
+		Format struct {
+			FormatName string `json:"format_name"`
+			Duration   string `json:"duration"`
+		} `json:"format"`
+		Streams []struct {
+			CodecType string `json:"codec_type"`
+			CodecName string `json:"codec_name"`
+			Width     int    `json:"width"`
+			Height    int    `json:"height"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(output, &probe); err != nil {
+		return info, nil
+	}
+
+	info.Duration, _ = strconv.ParseFloat(probe.Format.Duration, 64)
+	if info.Container == "" && probe.Format.FormatName != "" {
+		info.Container = strings.Split(probe.Format.FormatName, ",")[0]
+	}
+	for _, stream := range probe.Streams {
+		switch stream.CodecType {
+		case "audio":
+			if info.AudioCodec == "" || info.AudioCodec == "opus" {
+				info.AudioCodec = stream.CodecName
+			}
+		case "video":
+			if info.VideoCodec == "" {
+				info.VideoCodec = stream.CodecName
+				info.Width = stream.Width
+				info.Height = stream.Height
+			}
+		}
+	}
+	return info, nil
+}
+
+// ToVoiceNote garante áudio opus em container ogg, o formato usado pelas
+// mensagens de voz (PTT), e calcula o waveform e a duração exata.
+func (t *MediaTranscoder) ToVoiceNote(ctx context.Context, data []byte) (*TranscodeResult, error) {
+	info, err := t.Probe(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &TranscodeResult{Data: data, MimeType: "audio/ogg; codecs=opus", Duration: info.Duration}
+	if info.Container != "ogg" || info.AudioCodec != "opus" {
+		out, err := t.run(ctx, data, "ogg",
+			"-vn", "-map_metadata", "-1",
+			"-c:a", "libopus", "-b:a", "16k", "-ac", "1", "-ar", "48000",
+			"-avoid_negative_ts", "make_zero", "-f", "ogg")
+		if err != nil {
+			return nil, err
+		}
+		result.Data = out
+		result.Converted = true
+	}
+
+	waveform, seconds, err := t.AnalyzeVoice(ctx, result.Data)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		log.Warn().Err(err).Msg("Não foi possível gerar o waveform do áudio")
+		return result, nil
+	}
+	result.Waveform = waveform
+	result.Duration = seconds
+	return result, nil
+}
+
+// ToAudio prepara um áudio para envio. Com ptt=true gera uma mensagem de voz
+// (ver ToVoiceNote); caso contrário o áudio é enviado como arquivo, mantendo
+// mp3, m4a e ogg/opus e convertendo os demais formatos para ogg/opus.
+func (t *MediaTranscoder) ToAudio(ctx context.Context, data []byte, ptt bool) (*TranscodeResult, error) {
+	if ptt {
+		return t.ToVoiceNote(ctx, data)
+	}
+
+	info, err := t.Probe(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case info.Container == "mp3":
+		return &TranscodeResult{Data: data, MimeType: "audio/mpeg", Duration: info.Duration}, nil
+	case info.Container == "m4a" && (info.AudioCodec == "" || info.AudioCodec == "aac"):
+		return &TranscodeResult{Data: data, MimeType: "audio/mp4", Duration: info.Duration}, nil
+	case info.Container == "ogg" && info.AudioCodec == "opus":
+		return &TranscodeResult{Data: data, MimeType: "audio/ogg; codecs=opus", Duration: info.Duration}, nil
+	}
+
+	out, err := t.run(ctx, data, "ogg",
+		"-vn", "-map_metadata", "-1",
+		"-c:a", "libopus", "-b:a", "64k", "-ar", "48000",
+		"-avoid_negative_ts", "make_zero", "-f", "ogg")
+	if err != nil {
+		return nil, err
+	}
+	result := &TranscodeResult{Data: out, MimeType: "audio/ogg; codecs=opus", Converted: true}
+	if outInfo, err := t.Probe(ctx, out); err == nil {
+		result.Duration = outInfo.Duration
+	}
+	return result, nil
+}
+
+// ToVideo garante vídeo H.264/AAC em mp4 com o moov no início do arquivo.
+func (t *MediaTranscoder) ToVideo(ctx context.Context, data []byte) (*TranscodeResult, error) {
+	info, err := t.Probe(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+	if info.Container == "mp4" && info.VideoCodec == "h264" && (info.AudioCodec == "" || info.AudioCodec == "aac") {
+		return &TranscodeResult{Data: data, MimeType: "video/mp4", Duration: info.Duration, Width: info.Width, Height: info.Height}, nil
+	}
+
+	out, err := t.run(ctx, data, "mp4",
+		"-map_metadata", "-1",
+		"-c:v", "libx264", "-preset", "veryfast", "-profile:v", "main", "-pix_fmt", "yuv420p",
+		"-vf", "scale=trunc(iw/2)*2:trunc(ih/2)*2",
+		"-c:a", "aac", "-b:a", "128k",
+		"-movflags", "+faststart", "-f", "mp4")
+	if err != nil {
+		return nil, err
+	}
+	result := &TranscodeResult{Data: out, MimeType: "video/mp4", Converted: true}
+	if outInfo, err := t.Probe(ctx, out); err == nil {
+		result.Duration = outInfo.Duration
+		result.Width = outInfo.Width
+		result.Height = outInfo.Height
+	}
+	return result, nil
+}
+
+// run executa o ffmpeg sobre arquivos temporários, respeitando o timeout
+// configurado e o cancelamento do contexto (ex: cliente desconectou).
+func (t *MediaTranscoder) run(ctx context.Context, data []byte, outExt string, args ...string) ([]byte, error) {
+	ffmpeg, err := exec.LookPath(t.FFmpegPath)
+	if err != nil {
+		return nil, ErrFFmpegNotFound
+	}
+
+	input, cleanupInput, err := writeTempMedia(data, "transcode-in-*")
+	if err != nil {
+		return nil, err
+	}
+	defer cleanupInput()
+
+	outputFile, err := os.CreateTemp("", "transcode-out-*."+outExt)
+	if err != nil {
+		return nil, err
+	}
+	output := outputFile.Name()
+	outputFile.Close()
+	defer os.Remove(output)
+
+	ctx, cancel := context.WithTimeout(ctx, t.Timeout)
+	defer cancel()
+
+	cmdArgs := append([]string{"-hide_banner", "-nostdin", "-y", "-i", input}, args...)
+	cmdArgs = append(cmdArgs, output)
+	cmd := exec.CommandContext(ctx, ffmpeg, cmdArgs...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("ffmpeg excedeu o tempo limite de %s", t.Timeout)
+		}
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("conversão cancelada: %w", ctx.Err())
+		}
+		log.Error().Err(err).Str("stderr", lastLines(stderr.String(), 5)).Msg("Falha ao executar ffmpeg")
+		return nil, fmt.Errorf("falha ao converter mídia: %s", lastLines(stderr.String(), 1))
+	}
+
+	return os.ReadFile(output)
+}
+
+func writeTempMedia(data []byte, pattern string) (string, func(), error) {
+	file, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { os.Remove(file.Name()) }
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		cleanup()
+		return "", nil, err
+	}
+	if err := file.Close(); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return file.Name(), cleanup, nil
+}
+
+func lastLines(text string, n int) string {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
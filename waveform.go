@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os/exec"
+)
+
+// Quantidade de amostras do waveform exibido pelo WhatsApp nas mensagens de voz.
+const waveformSamples = 64
+
+// Taxa usada para decodificar o áudio ao calcular o waveform e a duração.
+const waveformSampleRate = 16000
+
+// AnalyzeVoice decodifica o áudio para PCM e retorna o waveform de 64
+// amostras (valores de 0 a 100) e a duração exata em segundos.
+func (t *MediaTranscoder) AnalyzeVoice(ctx context.Context, data []byte) ([]byte, float64, error) {
+	pcm, err := t.decodePCM(ctx, data)
+	if err != nil {
+		return nil, 0, err
+	}
+	seconds := float64(len(pcm)) / waveformSampleRate
+	return computeWaveform(pcm, waveformSamples), seconds, nil
+}
+
+// decodePCM converte o áudio para PCM 16 bits mono.
+func (t *MediaTranscoder) decodePCM(ctx context.Context, data []byte) ([]int16, error) {
+	ffmpeg, err := exec.LookPath(t.FFmpegPath)
+	if err != nil {
+		return nil, ErrFFmpegNotFound
+	}
+
+	input, cleanup, err := writeTempMedia(data, "waveform-*")
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(ctx, t.Timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, ffmpeg, "-hide_banner", "-nostdin", "-i", input,
+		"-vn", "-ac", "1", "-ar", fmt.Sprint(waveformSampleRate), "-f", "s16le", "-")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("decodificação do áudio interrompida: %w", ctx.Err())
+		}
+		return nil, fmt.Errorf("falha ao decodificar áudio: %s", lastLines(stderr.String(), 1))
+	}
+
+	raw := stdout.Bytes()
+	if len(raw) < 2 {
+		return nil, errors.New("áudio sem amostras")
+	}
+	samples := make([]int16, len(raw)/2)
+	for i := range samples {
+		samples[i] = int16(binary.LittleEndian.Uint16(raw[i*2:]))
+	}
+	return samples, nil
+}
+
+// computeWaveform divide as amostras em n blocos, calcula a amplitude média
+// de cada um e normaliza pelo maior valor para a escala de 0 a 100.
+func computeWaveform(samples []int16, n int) []byte {
+	waveform := make([]byte, n)
+	if len(samples) == 0 {
+		return waveform
+	}
+
+	blocks := make([]float64, n)
+	var peak float64
+	for i := 0; i < n; i++ {
+		start := i * len(samples) / n
+		end := (i + 1) * len(samples) / n
+		if end <= start {
+			continue
+		}
+		var sum float64
+		for _, sample := range samples[start:end] {
+			sum += math.Abs(float64(sample))
+		}
+		blocks[i] = sum / float64(end-start)
+		if blocks[i] > peak {
+			peak = blocks[i]
+		}
+	}
+
+	if peak == 0 {
+		return waveform
+	}
+	for i, value := range blocks {
+		waveform[i] = byte(math.Floor(100 * value / peak))
+	}
+	return waveform
+}
+
+// audioSeconds arredonda a duração para o campo Seconds das mensagens,
+// sem zerar áudios com menos de meio segundo.
+func audioSeconds(duration float64) uint32 {
+	if duration <= 0 {
+		return 0
+	}
+	return uint32(math.Max(1, math.Round(duration)))
+}
@@ -0,0 +1,501 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// Webhook payload formats a user can choose with POST /webhook
+const (
+	// the whatsmeow event struct as it is, under "event"
+	webhookFormatRaw = "v1-raw"
+	// the wuzapi event types below, wrapped in a WebhookEnvelope
+	webhookFormatTyped = "v2-typed"
+)
+
+// WebhookEnvelope is the body of every v2-typed webhook
+type WebhookEnvelope struct {
+	Version   string      `json:"version"`
+	Type      string      `json:"type"`
+	Timestamp time.Time   `json:"timestamp"`
+	Changes   []string    `json:"changes,omitempty"`
+	Event     interface{} `json:"event"`
+}
+
+// MessageEvent is sent for Message, Status and Newsletter.Message
+type MessageEvent struct {
+	ID         string         `json:"id"`
+	Chat       string         `json:"chat"`
+	Sender     string         `json:"sender"`
+	FromMe     bool           `json:"fromMe"`
+	IsGroup    bool           `json:"isGroup"`
+	PushName   string         `json:"pushName,omitempty"`
+	Timestamp  time.Time      `json:"timestamp"`
+	MentionsMe bool           `json:"mentionsMe"`
+	Content    MessageContent `json:"content"`
+}
+
+// ReceiptEvent is sent for ReadReceipt
+type ReceiptEvent struct {
+	MessageIDs []string  `json:"messageIds"`
+	Chat       string    `json:"chat"`
+	Sender     string    `json:"sender"`
+	IsGroup    bool      `json:"isGroup"`
+	State      string    `json:"state"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// PresenceEvent is sent for Presence
+type PresenceEvent struct {
+	From     string     `json:"from"`
+	State    string     `json:"state"`
+	LastSeen *time.Time `json:"lastSeen,omitempty"`
+}
+
+// ChatPresenceEvent is sent for ChatPresence
+type ChatPresenceEvent struct {
+	Chat   string `json:"chat"`
+	Sender string `json:"sender"`
+	State  string `json:"state"`
+	Media  string `json:"media,omitempty"`
+}
+
+// GroupEvent is sent for the Group events, only the changed fields are set
+type GroupEvent struct {
+	JID               string    `json:"jid"`
+	Sender            string    `json:"sender,omitempty"`
+	Timestamp         time.Time `json:"timestamp"`
+	Reason            string    `json:"reason,omitempty"`
+	Name              *string   `json:"name,omitempty"`
+	Topic             *string   `json:"topic,omitempty"`
+	Announce          *bool     `json:"announce,omitempty"`
+	Locked            *bool     `json:"locked,omitempty"`
+	DisappearingTimer *uint32   `json:"disappearingTimer,omitempty"`
+	InviteLink        *string   `json:"inviteLink,omitempty"`
+	Deleted           bool      `json:"deleted,omitempty"`
+	Joined            []string  `json:"joined,omitempty"`
+	Left              []string  `json:"left,omitempty"`
+	Promoted          []string  `json:"promoted,omitempty"`
+	Demoted           []string  `json:"demoted,omitempty"`
+}
+
+// ConnectionEvent is sent for the Connection events
+type ConnectionEvent struct {
+	JID          string `json:"jid,omitempty"`
+	BusinessName string `json:"businessName,omitempty"`
+	Platform     string `json:"platform,omitempty"`
+	Code         string `json:"code,omitempty"`
+	Reason       string `json:"reason,omitempty"`
+}
+
+// CallEvent is sent for the Call events
+type CallEvent struct {
+	CallID       string    `json:"callId"`
+	From         string    `json:"from"`
+	Creator      string    `json:"creator"`
+	Timestamp    time.Time `json:"timestamp"`
+	IsVideo      bool      `json:"isVideo"`
+	AutoRejected bool      `json:"autoRejected,omitempty"`
+	Reason       string    `json:"reason,omitempty"`
+}
+
+// ContactEvent is sent for Contact.Updated
+type ContactEvent struct {
+	JID          string `json:"jid"`
+	Source       string `json:"source"`
+	FullName     string `json:"fullName,omitempty"`
+	FirstName    string `json:"firstName,omitempty"`
+	PushName     string `json:"pushName,omitempty"`
+	BusinessName string `json:"businessName,omitempty"`
+}
+
+// PrivacySettingsEvent is sent for Privacy.SettingsChanged with the names of
+// the changed settings and the new value of all of them
+type PrivacySettingsEvent struct {
+	Settings     []string `json:"settings"`
+	GroupAdd     string   `json:"groupAdd"`
+	LastSeen     string   `json:"lastSeen"`
+	Status       string   `json:"status"`
+	Profile      string   `json:"profile"`
+	ReadReceipts string   `json:"readReceipts"`
+	Online       string   `json:"online"`
+	CallAdd      string   `json:"callAdd"`
+}
+
+// BlocklistEvent is sent for Privacy.BlocklistChanged. Action "modify" means
+// the whole blocklist changed and should be fetched again.
+type BlocklistEvent struct {
+	Action    string   `json:"action,omitempty"`
+	Blocked   []string `json:"blocked,omitempty"`
+	Unblocked []string `json:"unblocked,omitempty"`
+}
+
+// HistorySyncEvent is sent for HistorySync, the history itself is written
+// to the files of the user
+type HistorySyncEvent struct {
+	SyncType      string `json:"syncType"`
+	ChunkOrder    uint32 `json:"chunkOrder"`
+	Progress      uint32 `json:"progress"`
+	Conversations int    `json:"conversations"`
+	PushNames     int    `json:"pushNames"`
+}
+
+// NewsletterEvent is sent for Newsletter.Joined, Newsletter.Left and
+// Newsletter.MuteChanged
+type NewsletterEvent struct {
+	JID             string `json:"jid"`
+	Name            string `json:"name,omitempty"`
+	Description     string `json:"description,omitempty"`
+	SubscriberCount int    `json:"subscriberCount,omitempty"`
+	Role            string `json:"role,omitempty"`
+	Mute            string `json:"mute,omitempty"`
+}
+
+// NewsletterLiveUpdateEvent is sent for Newsletter.LiveUpdate
+type NewsletterLiveUpdateEvent struct {
+	JID       string                    `json:"jid"`
+	Timestamp time.Time                 `json:"timestamp"`
+	Messages  []NewsletterMessageCounts `json:"messages"`
+}
+
+// NewsletterMessageCounts are the view and reaction counts of a channel update
+type NewsletterMessageCounts struct {
+	ServerID  int            `json:"serverId"`
+	Views     int            `json:"views"`
+	Reactions map[string]int `json:"reactions"`
+}
+
+// webhookEventTypes lists the typed event of each webhook type, for the schema
+var webhookEventTypes = map[string]interface{}{
+	"Message":            MessageEvent{},
+	"Status":             MessageEvent{},
+	"Newsletter.Message": MessageEvent{},
+	"Interactive.Reply":  MessageEvent{},
+	"ReadReceipt":        ReceiptEvent{},
+	"Presence":           PresenceEvent{},
+	"ChatPresence":       ChatPresenceEvent{},
+	"Group":              GroupEvent{},
+	"Connection":         ConnectionEvent{},
+	"Call":               CallEvent{},
+	"Contact":            ContactEvent{},
+
+	"Privacy.SettingsChanged":  PrivacySettingsEvent{},
+	"Privacy.BlocklistChanged": BlocklistEvent{},
+	"HistorySync":              HistorySyncEvent{},
+	"Newsletter.Joined":        NewsletterEvent{},
+	"Newsletter.Left":          NewsletterEvent{},
+	"Newsletter.MuteChanged":   NewsletterEvent{},
+	"Newsletter.LiveUpdate":    NewsletterLiveUpdateEvent{},
+}
+
+// webhookJSON encodes a webhook body in the format chosen by the user
+func webhookJSON(format string, postmap map[string]interface{}) ([]byte, error) {
+	if format != webhookFormatTyped {
+		return json.Marshal(postmap)
+	}
+	eventType, _ := postmap["type"].(string)
+	changes, _ := postmap["changes"].([]string)
+	return json.Marshal(WebhookEnvelope{
+		Version:   "v2",
+		Type:      eventType,
+		Timestamp: time.Now().UTC(),
+		Changes:   changes,
+		Event:     typedWebhookEvent(postmap),
+	})
+}
+
+// typedWebhookEvent converts the event of a webhook to its wuzapi type. Values
+// computed while handling the event (state, source, settings, ...) are read
+// from the postmap.
+func typedWebhookEvent(postmap map[string]interface{}) interface{} {
+	switch evt := postmap["event"].(type) {
+	case *events.Message:
+		mentionsMe, _ := postmap["mentionsMe"].(bool)
+		return MessageEvent{
+			ID:         evt.Info.ID,
+			Chat:       evt.Info.Chat.String(),
+			Sender:     evt.Info.Sender.String(),
+			FromMe:     evt.Info.IsFromMe,
+			IsGroup:    evt.Info.IsGroup,
+			PushName:   evt.Info.PushName,
+			Timestamp:  evt.Info.Timestamp,
+			MentionsMe: mentionsMe,
+			Content:    eventMessageContent(evt),
+		}
+	case *events.Receipt:
+		state, _ := postmap["state"].(string)
+		return ReceiptEvent{
+			MessageIDs: evt.MessageIDs,
+			Chat:       evt.Chat.String(),
+			Sender:     evt.Sender.String(),
+			IsGroup:    evt.IsGroup,
+			State:      state,
+			Timestamp:  evt.Timestamp,
+		}
+	case *events.Presence:
+		state, _ := postmap["state"].(string)
+		presence := PresenceEvent{From: evt.From.String(), State: state}
+		if !evt.LastSeen.IsZero() {
+			presence.LastSeen = &evt.LastSeen
+		}
+		return presence
+	case *events.ChatPresence:
+		return ChatPresenceEvent{
+			Chat:   evt.Chat.String(),
+			Sender: evt.Sender.String(),
+			State:  string(evt.State),
+			Media:  string(evt.Media),
+		}
+	case *events.JoinedGroup:
+		group := GroupEvent{JID: evt.JID.String(), Timestamp: time.Now().UTC(), Reason: evt.Reason, Name: &evt.Name, Topic: &evt.Topic}
+		for _, participant := range evt.Participants {
+			group.Joined = append(group.Joined, participant.JID.String())
+		}
+		return group
+	case *events.GroupInfo:
+		return groupInfoEvent(evt)
+	case *events.PairSuccess:
+		return ConnectionEvent{JID: evt.ID.String(), BusinessName: evt.BusinessName, Platform: evt.Platform}
+	case map[string]interface{}:
+		// QR code and logout webhooks are built as maps
+		code, _ := evt["code"].(string)
+		reason, _ := evt["reason"].(string)
+		return ConnectionEvent{Code: code, Reason: reason}
+	case *events.CallOffer:
+		return callEvent(evt.BasicCallMeta, postmap, "")
+	case *events.CallOfferNotice:
+		return callEvent(evt.BasicCallMeta, postmap, "")
+	case *events.CallAccept:
+		return callEvent(evt.BasicCallMeta, postmap, "")
+	case *events.CallReject:
+		return callEvent(evt.BasicCallMeta, postmap, "")
+	case *events.CallTerminate:
+		return callEvent(evt.BasicCallMeta, postmap, evt.Reason)
+	case *events.Contact:
+		source, _ := postmap["source"].(string)
+		return ContactEvent{JID: evt.JID.String(), Source: source, FullName: evt.Action.GetFullName(), FirstName: evt.Action.GetFirstName()}
+	case *events.PushName:
+		source, _ := postmap["source"].(string)
+		return ContactEvent{JID: evt.JID.String(), Source: source, PushName: evt.NewPushName}
+	case *events.BusinessName:
+		source, _ := postmap["source"].(string)
+		return ContactEvent{JID: evt.JID.String(), Source: source, BusinessName: evt.NewBusinessName}
+	case *events.PrivacySettings:
+		settings, _ := postmap["settings"].([]string)
+		return PrivacySettingsEvent{
+			Settings:     settings,
+			GroupAdd:     string(evt.NewSettings.GroupAdd),
+			LastSeen:     string(evt.NewSettings.LastSeen),
+			Status:       string(evt.NewSettings.Status),
+			Profile:      string(evt.NewSettings.Profile),
+			ReadReceipts: string(evt.NewSettings.ReadReceipts),
+			Online:       string(evt.NewSettings.Online),
+			CallAdd:      string(evt.NewSettings.CallAdd),
+		}
+	case *events.Blocklist:
+		blocklist := BlocklistEvent{Action: string(evt.Action)}
+		for _, change := range evt.Changes {
+			switch change.Action {
+			case events.BlocklistChangeActionBlock:
+				blocklist.Blocked = append(blocklist.Blocked, change.JID.String())
+			case events.BlocklistChangeActionUnblock:
+				blocklist.Unblocked = append(blocklist.Unblocked, change.JID.String())
+			}
+		}
+		return blocklist
+	case *events.HistorySync:
+		return HistorySyncEvent{
+			SyncType:      evt.Data.GetSyncType().String(),
+			ChunkOrder:    evt.Data.GetChunkOrder(),
+			Progress:      evt.Data.GetProgress(),
+			Conversations: len(evt.Data.GetConversations()),
+			PushNames:     len(evt.Data.GetPushnames()),
+		}
+	case *events.NewsletterJoin:
+		newsletter := NewsletterEvent{
+			JID:             evt.ID.String(),
+			Name:            evt.ThreadMeta.Name.Text,
+			Description:     evt.ThreadMeta.Description.Text,
+			SubscriberCount: evt.ThreadMeta.SubscriberCount,
+		}
+		if evt.ViewerMeta != nil {
+			newsletter.Role = string(evt.ViewerMeta.Role)
+			newsletter.Mute = string(evt.ViewerMeta.Mute)
+		}
+		return newsletter
+	case *events.NewsletterLeave:
+		return NewsletterEvent{JID: evt.ID.String(), Role: string(evt.Role)}
+	case *events.NewsletterMuteChange:
+		return NewsletterEvent{JID: evt.ID.String(), Mute: string(evt.Mute)}
+	case *events.NewsletterLiveUpdate:
+		update := NewsletterLiveUpdateEvent{JID: evt.JID.String(), Timestamp: evt.Time, Messages: []NewsletterMessageCounts{}}
+		for _, message := range evt.Messages {
+			update.Messages = append(update.Messages, NewsletterMessageCounts{
+				ServerID:  int(message.MessageServerID),
+				Views:     message.ViewsCount,
+				Reactions: message.ReactionCounts,
+			})
+		}
+		return update
+	}
+	log.Warn().Str("type", fmt.Sprintf("%T", postmap["event"])).Msg("No typed webhook event for this event")
+	return nil
+}
+
+func groupInfoEvent(evt *events.GroupInfo) GroupEvent {
+	group := GroupEvent{
+		JID:        evt.JID.String(),
+		Timestamp:  evt.Timestamp,
+		Reason:     evt.JoinReason,
+		InviteLink: evt.NewInviteLink,
+		Joined:     jidStrings(evt.Join),
+		Left:       jidStrings(evt.Leave),
+		Promoted:   jidStrings(evt.Promote),
+		Demoted:    jidStrings(evt.Demote),
+	}
+	if evt.Sender != nil {
+		group.Sender = evt.Sender.String()
+	}
+	if evt.Name != nil {
+		group.Name = &evt.Name.Name
+	}
+	if evt.Topic != nil {
+		group.Topic = &evt.Topic.Topic
+	}
+	if evt.Announce != nil {
+		group.Announce = &evt.Announce.IsAnnounce
+	}
+	if evt.Locked != nil {
+		group.Locked = &evt.Locked.IsLocked
+	}
+	if evt.Ephemeral != nil {
+		group.DisappearingTimer = &evt.Ephemeral.DisappearingTimer
+	}
+	if evt.Delete != nil {
+		group.Deleted = evt.Delete.Deleted
+	}
+	return group
+}
+
+func callEvent(meta types.BasicCallMeta, postmap map[string]interface{}, reason string) CallEvent {
+	isVideo, _ := postmap["isVideo"].(bool)
+	autoRejected, _ := postmap["autoRejected"].(bool)
+	return CallEvent{
+		CallID:       meta.CallID,
+		From:         meta.From.String(),
+		Creator:      meta.CallCreator.String(),
+		Timestamp:    meta.Timestamp,
+		IsVideo:      isVideo,
+		AutoRejected: autoRejected,
+		Reason:       reason,
+	}
+}
+
+func jidStrings(jids []types.JID) []string {
+	var list []string
+	for _, jid := range jids {
+		list = append(list, jid.String())
+	}
+	return list
+}
+
+// jsonSchema describes a Go type as JSON Schema, following the json tags
+func jsonSchema(t reflect.Type) map[string]interface{} {
+	switch t {
+	case reflect.TypeOf(time.Time{}):
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case reflect.TypeOf([]byte{}):
+		return map[string]interface{}{"type": "string", "contentEncoding": "base64"}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return jsonSchema(t.Elem())
+	case reflect.Interface:
+		return map[string]interface{}{}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": jsonSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": jsonSchema(t.Elem())}
+	case reflect.Struct:
+		properties := map[string]interface{}{}
+		required := []string{}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" || !field.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			properties[name] = jsonSchema(field.Type)
+			if options != "omitempty" && field.Type.Kind() != reflect.Ptr {
+				required = append(required, name)
+			}
+		}
+		return map[string]interface{}{"type": "object", "properties": properties, "required": required}
+	}
+	return map[string]interface{}{}
+}
+
+// webhookSchema is the JSON Schema of the v2-typed webhook envelope
+func webhookSchema() map[string]interface{} {
+	definitions := map[string]interface{}{}
+	var refs []map[string]interface{}
+	eventTypes := map[string][]string{}
+	for eventType, dto := range webhookEventTypes {
+		name := reflect.TypeOf(dto).Name()
+		if _, ok := definitions[name]; !ok {
+			definitions[name] = jsonSchema(reflect.TypeOf(dto))
+			refs = append(refs, map[string]interface{}{"$ref": "#/$defs/" + name})
+		}
+		eventTypes[name] = append(eventTypes[name], eventType)
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i]["$ref"].(string) < refs[j]["$ref"].(string) })
+	for name := range eventTypes {
+		sort.Strings(eventTypes[name])
+		definitions[name].(map[string]interface{})["x-eventTypes"] = eventTypes[name]
+	}
+
+	schema := jsonSchema(reflect.TypeOf(WebhookEnvelope{}))
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["title"] = "wuzapi webhook " + webhookFormatTyped
+	schema["$defs"] = definitions
+	schema["properties"].(map[string]interface{})["version"] = map[string]interface{}{"const": "v2"}
+	schema["properties"].(map[string]interface{})["event"] = map[string]interface{}{"anyOf": refs}
+	return schema
+}
+
+// Gets the JSON Schema of v2-typed webhooks
+func (s *server) GetWebhookSchema() http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		responseJson, err := json.Marshal(webhookSchema())
+
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+		} else {
+			s.Respond(w, r, http.StatusOK, string(responseJson))
+		}
+
+		return
+	}
+}
@@ -43,11 +43,14 @@ type MyClient struct {
 	token          string
 	subscriptions  []string
 	db             *sqlx.DB
+	resolver       *JIDResolver
+	messages       *MessageStore
+	ownLID         *ownLIDCache
 }
 
 // Connects to Whatsapp Websocket on server startup if last state was connected
 func (s *server) connectOnStartup() {
-	rows, err := s.db.Queryx("SELECT id,token,jid,webhook,events FROM users WHERE connected=1")
+	rows, err := s.db.Queryx("SELECT id,token,jid,webhook,events,webhook_format FROM users WHERE connected=1")
 	if err != nil {
 		log.Error().Err(err).Msg("DB Problem")
 		return
@@ -59,18 +62,20 @@ func (s *server) connectOnStartup() {
 		jid := ""
 		webhook := ""
 		events := ""
-		err = rows.Scan(&txtid, &token, &jid, &webhook, &events)
+		webhookFormat := ""
+		err = rows.Scan(&txtid, &token, &jid, &webhook, &events, &webhookFormat)
 		if err != nil {
 			log.Error().Err(err).Msg("DB Problem")
 			return
 		} else {
 			log.Info().Str("token", token).Msg("Connect to Whatsapp on startup")
 			v := Values{map[string]string{
-				"Id":      txtid,
-				"Jid":     jid,
-				"Webhook": webhook,
-				"Token":   token,
-				"Events":  events,
+				"Id":            txtid,
+				"Jid":           jid,
+				"Webhook":       webhook,
+				"Token":         token,
+				"Events":        events,
+				"WebhookFormat": webhookFormat,
 			}}
 			userinfocache.Set(token, v, cache.NoExpiration)
 			userid, _ := strconv.Atoi(txtid)
@@ -84,7 +89,7 @@ func (s *server) connectOnStartup() {
 				}
 			} else {
 				for _, arg := range eventarray {
-					if !Find(messageTypes, arg) {
+					if !isKnownEventType(arg) {
 						log.Warn().Str("Type",arg).Msg("Message type discarded")
 						continue
 					}
@@ -171,7 +176,7 @@ func (s *server) startClient(userID int, textjid string, token string, subscript
 		client = whatsmeow.NewClient(deviceStore, nil)
 	}
 	clientPointer[userID] = client
-	mycli := MyClient{client, 1, userID, token, subscriptions, s.db}
+	mycli := MyClient{client, 1, userID, token, subscriptions, s.db, s.resolver, s.messages, &ownLIDCache{}}
 	mycli.eventHandlerID = mycli.WAClient.AddEventHandler(mycli.myEventHandler)
 
 	//clientHttp[userID] = resty.New().EnableTrace()
@@ -227,15 +232,14 @@ func (s *server) startClient(userID int, textjid string, token string, subscript
 					postmap["type"] = "Connection.QRCode"
 					postmap["event"] = map[string]interface{}{"code": evt.Code}
 
-					jsonData, _ := json.Marshal(postmap)
-					data := map[string]string{
-						"jsonData": string(jsonData),
-						"token":    token,
-					}
-
 					myuserinfo, found := userinfocache.Get(token)
 					if found {
 						webhookurl := myuserinfo.(Values).Get("Webhook")
+						jsonData, _ := webhookJSON(myuserinfo.(Values).Get("WebhookFormat"), postmap)
+						data := map[string]string{
+							"jsonData": string(jsonData),
+							"token":    token,
+						}
 						if webhookurl != "" {
 							go callHook(webhookurl, data, userID)
 						}
@@ -253,16 +257,16 @@ func (s *server) startClient(userID int, textjid string, token string, subscript
 					postmap := make(map[string]interface{})
 					postmap["type"] = "Connection.QRTimeout"
 					postmap["event"] = map[string]interface{}{"code": evt.Code}
-					jsonData, _ := json.Marshal(postmap)
-					data := map[string]string{
-						"jsonData": string(jsonData),
-						"token":    token,
-					}
 
 					// Obtém webhook do usuário
 					myuserinfo, found := userinfocache.Get(token)
 					if found {
 						webhookurl := myuserinfo.(Values).Get("Webhook")
+						jsonData, _ := webhookJSON(myuserinfo.(Values).Get("WebhookFormat"), postmap)
+						data := map[string]string{
+							"jsonData": string(jsonData),
+							"token":    token,
+						}
 						if webhookurl != "" {
 							go callHook(webhookurl, data, userID)
 						}
@@ -309,7 +313,7 @@ func (s *server) startClient(userID int, textjid string, token string, subscript
 			if found {
 				webhookurl := myuserinfo.(Values).Get("Webhook")
 				if webhookurl != "" {
-					jsonData, err := json.Marshal(postmap)
+					jsonData, err := webhookJSON(myuserinfo.(Values).Get("WebhookFormat"), postmap)
 					if err == nil {
 						data := map[string]string{
 							"jsonData": string(jsonData),
@@ -415,6 +419,9 @@ func (mycli *MyClient) myEventHandler(rawEvt interface{}) {
 			log.Error().Err(err).Msg(sqlStmt)
 			return
 		}
+		if _, ok := evt.(*events.Connected); ok {
+			go rememberOwnLID(mycli.WAClient, mycli.resolver, mycli.ownLID)
+		}
 	case *events.PairSuccess:
 		postmap["type"] = "Connection.PairSuccess"
 		dowebhook = 1
@@ -445,7 +452,31 @@ func (mycli *MyClient) myEventHandler(rawEvt interface{}) {
 	case *events.Message:
 		logEventToFile(fmt.Sprintf("Message event: {type: %T, event: %+v}", evt, evt))
 		postmap["type"] = "Message"
+		// statuses (stories) of contacts arrive on the status broadcast chat
+		if evt.Info.Chat == types.StatusBroadcastJID {
+			postmap["type"] = "Status"
+		} else if evt.Info.Chat.Server == types.NewsletterServer {
+			postmap["type"] = "Newsletter.Message"
+		}
 		dowebhook = 1
+		mycli.messages.Save(mycli.userID, evt.Info, evt.Message)
+		rememberChatExpiration(mycli.db, mycli.resolver, mycli.userID, evt)
+		content := eventMessageContent(evt)
+		postmap["content"] = content
+		// choices made on buttons and lists get their own webhook type
+		if content.Reply != nil {
+			postmap["type"] = "Interactive.Reply"
+			log.Info().Str("id",evt.Info.ID).Str("kind",content.Reply.Kind).Str("selected",content.Reply.ID).Str("original",content.Reply.MessageID).Msg("Interactive reply received")
+		}
+		if mycli.WAClient.Store.ID != nil {
+			me := mycli.WAClient.Store.ID.ToNonAD()
+			mentioned := false
+			// the LID is only needed when the message mentions someone
+			if inner, _ := unwrapMessage(evt.Message); len(messageContextInfo(inner).GetMentionedJID()) > 0 {
+				mentioned = mentionsJID(evt.Message, me, mycli.ownLID.get(mycli.resolver, me))
+			}
+			postmap["mentionsMe"] = mentioned
+		}
 		metaParts := []string{fmt.Sprintf("pushname: %s", evt.Info.PushName), fmt.Sprintf("timestamp: %s", evt.Info.Timestamp)}
 		if evt.Info.Type != "" {
 			metaParts = append(metaParts, fmt.Sprintf("type: %s", evt.Info.Type))
@@ -456,7 +487,7 @@ func (mycli *MyClient) myEventHandler(rawEvt interface{}) {
 		if evt.IsViewOnce {
 			metaParts = append(metaParts, "view once")
 		}
-		if evt.IsViewOnce {
+		if evt.IsEphemeral {
 			metaParts = append(metaParts, "ephemeral")
 		}
 
@@ -469,7 +500,7 @@ func (mycli *MyClient) myEventHandler(rawEvt interface{}) {
 		postmap["type"] = "ReadReceipt"
 		dowebhook = 1
 		if evt.Type == events.ReceiptTypeRead || evt.Type == events.ReceiptTypeReadSelf {
-			log.Info().Strs("id",evt.MessageIDs).Str("source",evt.SourceString()).Str("timestamp",fmt.Sprintf("%d",evt.Timestamp)).Msg("Message was read")
+			log.Info().Strs("id",evt.MessageIDs).Str("source",evt.SourceString()).Str("timestamp",fmt.Sprintf("%v",evt.Timestamp)).Msg("Message was read")
 			if evt.Type == events.ReceiptTypeRead {
 				postmap["state"] = "Read"
 			} else {
@@ -477,7 +508,7 @@ func (mycli *MyClient) myEventHandler(rawEvt interface{}) {
 			}
 		} else if evt.Type == events.ReceiptTypeDelivered {
 			postmap["state"] = "Delivered"
-			log.Info().Str("id",evt.MessageIDs[0]).Str("source",evt.SourceString()).Str("timestamp",fmt.Sprintf("%d",evt.Timestamp)).Msg("Message delivered")
+			log.Info().Str("id",evt.MessageIDs[0]).Str("source",evt.SourceString()).Str("timestamp",fmt.Sprintf("%v",evt.Timestamp)).Msg("Message delivered")
 		} else {
 			// Discard webhooks for inactive or other delivery types
 			return
@@ -491,7 +522,7 @@ func (mycli *MyClient) myEventHandler(rawEvt interface{}) {
 			if evt.LastSeen.IsZero() {
 				log.Info().Str("from",evt.From.String()).Msg("User is now offline")
 			} else {
-				log.Info().Str("from",evt.From.String()).Str("lastSeen",fmt.Sprintf("%d",evt.LastSeen)).Msg("User is now offline")
+				log.Info().Str("from",evt.From.String()).Str("lastSeen",fmt.Sprintf("%v",evt.LastSeen)).Msg("User is now offline")
 			}
 		} else {
 			postmap["state"] = "online"
@@ -553,20 +584,134 @@ func (mycli *MyClient) myEventHandler(rawEvt interface{}) {
 		log.Info().Str("state",fmt.Sprintf("%s",evt.State)).Str("media",fmt.Sprintf("%s",evt.Media)).Str("chat",evt.MessageSource.Chat.String()).Str("sender",evt.MessageSource.Sender.String()).Msg("Chat Presence received")
 	case *events.CallOffer:
 		logEventToFile(fmt.Sprintf("CallOffer event: {type: %T, event: %+v}", evt, evt))
-		log.Info().Str("event",fmt.Sprintf("%+v",evt)).Msg("Got call offer")
+		postmap["type"] = "Call.Offer"
+		dowebhook = 1
+		_, isVideo := evt.Data.GetOptionalChildByTag("video")
+		postmap["isVideo"] = isVideo
+		outcome := waProto.CallLogMessage_ONGOING
+		if settings := loadCallSettings(mycli.db, mycli.userID); settings.AutoReject {
+			expiration := chatExpiration(mycli.db, mycli.resolver, mycli.WAClient, mycli.userID, evt.From.ToNonAD())
+			err := autoRejectCall(mycli.WAClient, settings, evt.From, evt.CallID, expiration)
+			if err != nil {
+				log.Error().Err(err).Str("call",evt.CallID).Msg("Could not auto reject call")
+			} else {
+				outcome = waProto.CallLogMessage_REJECTED
+				postmap["autoRejected"] = true
+			}
+		}
+		logCall(mycli.messages, mycli.userID, evt.BasicCallMeta, isVideo, outcome)
+		log.Info().Str("from",evt.From.String()).Str("call",evt.CallID).Bool("video",isVideo).Msg("Got call offer")
 	case *events.CallAccept:
 		logEventToFile(fmt.Sprintf("CallAccept event: {type: %T, event: %+v}", evt, evt))
-		log.Info().Str("event",fmt.Sprintf("%+v",evt)).Msg("Got call accept")
+		postmap["type"] = "Call.Accepted"
+		dowebhook = 1
+		logCall(mycli.messages, mycli.userID, evt.BasicCallMeta, false, waProto.CallLogMessage_CONNECTED)
+		log.Info().Str("from",evt.From.String()).Str("call",evt.CallID).Msg("Got call accept")
+	case *events.CallReject:
+		logEventToFile(fmt.Sprintf("CallReject event: {type: %T, event: %+v}", evt, evt))
+		postmap["type"] = "Call.Rejected"
+		dowebhook = 1
+		logCall(mycli.messages, mycli.userID, evt.BasicCallMeta, false, waProto.CallLogMessage_REJECTED)
+		log.Info().Str("from",evt.From.String()).Str("call",evt.CallID).Msg("Got call reject")
 	case *events.CallTerminate:
 		logEventToFile(fmt.Sprintf("CallTerminate event: {type: %T, event: %+v}", evt, evt))
-		log.Info().Str("event",fmt.Sprintf("%+v",evt)).Msg("Got call terminate")
+		postmap["type"] = "Call.Terminated"
+		dowebhook = 1
+		// calls that were never answered end as missed
+		outcome := waProto.CallLogMessage_MISSED
+		if stored, err := mycli.messages.Get(mycli.userID, evt.From.ToNonAD(), evt.CallID); err == nil {
+			if msg, err := stored.Decode(); err == nil && msg.GetCallLogMesssage().GetCallOutcome() != waProto.CallLogMessage_ONGOING {
+				outcome = msg.GetCallLogMesssage().GetCallOutcome()
+			}
+		}
+		logCall(mycli.messages, mycli.userID, evt.BasicCallMeta, false, outcome)
+		log.Info().Str("from",evt.From.String()).Str("call",evt.CallID).Str("reason",evt.Reason).Msg("Got call terminate")
 	case *events.CallOfferNotice:
 		logEventToFile(fmt.Sprintf("CallOfferNotice event: {type: %T, event: %+v}", evt, evt))
-		log.Info().Str("event",fmt.Sprintf("%+v",evt)).Msg("Got call offer notice")
+		postmap["type"] = "Call.Offer"
+		postmap["isVideo"] = evt.Media == "video"
+		dowebhook = 1
+		outcome := waProto.CallLogMessage_ONGOING
+		if settings := loadCallSettings(mycli.db, mycli.userID); settings.AutoReject {
+			// the creator is the caller, also in group and notice calls
+			caller := evt.CallCreator
+			if caller.IsEmpty() {
+				caller = evt.From
+			}
+			expiration := chatExpiration(mycli.db, mycli.resolver, mycli.WAClient, mycli.userID, caller.ToNonAD())
+			err := autoRejectCall(mycli.WAClient, settings, caller, evt.CallID, expiration)
+			if err != nil {
+				log.Error().Err(err).Str("call",evt.CallID).Msg("Could not auto reject call")
+			} else {
+				outcome = waProto.CallLogMessage_REJECTED
+				postmap["autoRejected"] = true
+			}
+		}
+		logCall(mycli.messages, mycli.userID, evt.BasicCallMeta, evt.Media == "video", outcome)
+		log.Info().Str("from",evt.From.String()).Str("call",evt.CallID).Str("type",evt.Type).Msg("Got call offer notice")
 	case *events.CallRelayLatency:
 		logEventToFile(fmt.Sprintf("CallRelayLatency event: {type: %T, event: %+v}", evt, evt))
 		log.Info().Str("event",fmt.Sprintf("%+v",evt)).Msg("Got call relay latency")
 
+	case *events.JoinedGroup:
+		logEventToFile(fmt.Sprintf("JoinedGroup event: {type: %T, event: %+v}", evt, evt))
+		postmap["type"] = "Group.Joined"
+		dowebhook = 1
+		log.Info().Str("group",evt.JID.String()).Str("reason",evt.Reason).Str("type",evt.Type).Msg("Joined group")
+		mycli.resolver.RememberParticipants(evt.Participants)
+	case *events.GroupInfo:
+		logEventToFile(fmt.Sprintf("GroupInfo event: {type: %T, event: %+v}", evt, evt))
+		changes := groupInfoChanges(evt)
+		if evt.Ephemeral != nil {
+			var expiration uint32
+			if evt.Ephemeral.IsEphemeral {
+				expiration = evt.Ephemeral.DisappearingTimer
+			}
+			saveChatExpiration(mycli.db, mycli.resolver, mycli.userID, evt.JID, expiration)
+		}
+		postmap["type"] = changes[0]
+		postmap["changes"] = changes
+		dowebhook = 1
+		log.Info().Str("group",evt.JID.String()).Strs("changes",changes).Msg("Group info changed")
+	case *events.Contact:
+		logEventToFile(fmt.Sprintf("Contact event: {type: %T, event: %+v}", evt, evt))
+		// full syncs replay the whole address book, skip them to avoid flooding the webhook
+		if evt.FromFullSync {
+			return
+		}
+		postmap["type"] = "Contact.Updated"
+		postmap["source"] = "addressbook"
+		dowebhook = 1
+		log.Info().Str("jid",evt.JID.String()).Str("fullName",evt.Action.GetFullName()).Msg("Contact updated")
+	case *events.PushName:
+		logEventToFile(fmt.Sprintf("PushName event: {type: %T, event: %+v}", evt, evt))
+		postmap["type"] = "Contact.Updated"
+		postmap["source"] = "pushname"
+		dowebhook = 1
+		log.Info().Str("jid",evt.JID.String()).Str("old",evt.OldPushName).Str("new",evt.NewPushName).Msg("Contact push name changed")
+	case *events.BusinessName:
+		logEventToFile(fmt.Sprintf("BusinessName event: {type: %T, event: %+v}", evt, evt))
+		postmap["type"] = "Contact.Updated"
+		postmap["source"] = "businessname"
+		dowebhook = 1
+		log.Info().Str("jid",evt.JID.String()).Str("old",evt.OldBusinessName).Str("new",evt.NewBusinessName).Msg("Contact business name changed")
+	case *events.PrivacySettings:
+		logEventToFile(fmt.Sprintf("PrivacySettings event: {type: %T, event: %+v}", evt, evt))
+		settings := changedPrivacySettings(evt)
+		postmap["type"] = "Privacy.SettingsChanged"
+		postmap["settings"] = settings
+		dowebhook = 1
+		log.Info().Strs("settings",settings).Msg("Privacy settings changed")
+	case *events.Blocklist:
+		logEventToFile(fmt.Sprintf("Blocklist event: {type: %T, event: %+v}", evt, evt))
+		postmap["type"] = "Privacy.BlocklistChanged"
+		dowebhook = 1
+		log.Info().Str("action",string(evt.Action)).Int("changes",len(evt.Changes)).Msg("Blocklist changed")
+	case *events.NewsletterJoin, *events.NewsletterLeave, *events.NewsletterMuteChange, *events.NewsletterLiveUpdate:
+		logEventToFile(fmt.Sprintf("Newsletter event: {type: %T, event: %+v}", evt, evt))
+		postmap["type"] = newsletterEventType(evt)
+		dowebhook = 1
+		log.Info().Str("type",postmap["type"].(string)).Msg("Newsletter event")
 	case *events.QR:
 		logEventToFile(fmt.Sprintf("QR event: {type: %T, event: %+v}", evt, evt))
 		log.Info().Str("event",fmt.Sprintf("%+v",evt)).Msg("Got QR")
@@ -578,21 +723,34 @@ func (mycli *MyClient) myEventHandler(rawEvt interface{}) {
 	if dowebhook == 1 {
 		// call webhook
 		webhookurl := ""
+		webhookFormat := ""
 		myuserinfo, found := userinfocache.Get(mycli.token)
 		if !found {
 			log.Warn().Str("token",mycli.token).Msg("Could not call webhook as there is no user for this token")
 		} else {
 			webhookurl = myuserinfo.(Values).Get("Webhook")
+			webhookFormat = myuserinfo.(Values).Get("WebhookFormat")
 		}
 
-		if !Find(mycli.subscriptions, postmap["type"].(string)) && !Find(mycli.subscriptions, "All") {
+		subscribed := isSubscribed(mycli.subscriptions, postmap["type"].(string))
+		if changes, ok := postmap["changes"].([]string); ok {
+			for _, change := range changes {
+				subscribed = subscribed || isSubscribed(mycli.subscriptions, change)
+			}
+		}
+		// replies to buttons and lists are messages, and were sent as Message
+		// before they had their own type
+		if postmap["type"] == "Interactive.Reply" {
+			subscribed = subscribed || isSubscribed(mycli.subscriptions, "Message")
+		}
+		if !subscribed {
 			log.Warn().Str("type",postmap["type"].(string)).Msg("Skipping webhook. Not subscribed for this type")
 			return
 		}
 
 if webhookurl != "" {
     log.Info().Str("url",webhookurl).Msg("Calling webhook")
-    jsonData, err := json.Marshal(postmap)
+    jsonData, err := webhookJSON(webhookFormat, postmap)
     if err != nil {
         log.Error().Err(err).Msg("Failed to marshal postmap to JSON")
     } else {
@@ -637,3 +795,40 @@ func logEventToFile(eventType string, evt interface{}) {
 	// Registra o evento formatado com quebras de linha
 	log.Println(fmt.Sprintf("%s:\n%s", eventType, string(eventJSON)))
 }
+
+// groupInfoChanges lists the webhook types for a group change, the first
+// one is used as the event type
+func groupInfoChanges(evt *events.GroupInfo) []string {
+	var changes []string
+	if len(evt.Join) > 0 {
+		changes = append(changes, "Group.ParticipantsJoined")
+	}
+	if len(evt.Leave) > 0 {
+		changes = append(changes, "Group.ParticipantsLeft")
+	}
+	if len(evt.Promote) > 0 {
+		changes = append(changes, "Group.ParticipantsPromoted")
+	}
+	if len(evt.Demote) > 0 {
+		changes = append(changes, "Group.ParticipantsDemoted")
+	}
+	if evt.Name != nil {
+		changes = append(changes, "Group.NameChanged")
+	}
+	if evt.Topic != nil {
+		changes = append(changes, "Group.TopicChanged")
+	}
+	if evt.Announce != nil || evt.Locked != nil || evt.Ephemeral != nil || evt.MembershipApprovalMode != nil {
+		changes = append(changes, "Group.SettingsChanged")
+	}
+	if evt.NewInviteLink != nil {
+		changes = append(changes, "Group.InviteLinkChanged")
+	}
+	if evt.Delete != nil {
+		changes = append(changes, "Group.Deleted")
+	}
+	if len(changes) == 0 {
+		changes = append(changes, "Group.Updated")
+	}
+	return changes
+}